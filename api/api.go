@@ -0,0 +1,154 @@
+// Package api defines the wire types shared by the clipshare server and
+// client.
+package api
+
+import "time"
+
+// SetRequest sets the clipboard content. Text is stored unless the request
+// uploads a file, see IsFile.
+type SetRequest struct {
+	Text   string `json:"text"`
+	Device string `json:"device"`
+
+	Data     []byte `json:"data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+}
+
+// IsFile reports whether the request uploads a file. Empty files are sent
+// without data, so their file name or MIME type identifies them.
+func (r SetRequest) IsFile() bool {
+	return r.Data != nil || r.Filename != "" || r.MIMEType != ""
+}
+
+// Event types sent on the change feed.
+const (
+	// EventSnapshot is sent once when a subscriber connects and carries the
+	// current content.
+	EventSnapshot = "snapshot"
+	EventSet      = "set"
+	EventClear    = "clear"
+	EventExpire   = "expire"
+
+	// EventPin and EventUnpin are sent when the content is pinned, and kept
+	// past the TTL, or unpinned. They carry the content.
+	EventPin   = "pin"
+	EventUnpin = "unpin"
+)
+
+// Event describes a change of the content of a channel. Text is only set
+// for text content.
+type Event struct {
+	Type     string `json:"type"`
+	Channel  string `json:"channel"`
+	Text     string `json:"text"`
+	Device   string `json:"device,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+
+	// Sensitive is set when the content looks like a secret.
+	Sensitive bool `json:"sensitive,omitempty"`
+
+	// User set the content, when authenticated by a trusted proxy.
+	User User `json:"user,omitzero"`
+
+	// Pinned is set while the content is kept past the TTL, until
+	// ExpiresAt.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// ExpiresAt is when the content will be cleared. It is zero when the
+	// channel is empty.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// WebhookEvent is the body of the requests sent to webhook targets. Text
+// and Data are only set when the policy of the target allows it.
+type WebhookEvent struct {
+	Event
+	Data []byte `json:"data,omitempty"`
+
+	// Time is when the event happened.
+	Time time.Time `json:"time"`
+}
+
+// User is a user authenticated by a trusted proxy, such as Tailscale Serve.
+type User struct {
+	Login string `json:"login"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Clip is the content of a channel, as returned by the versioned API. Text
+// is only set for text content, and Data for files. An empty channel has
+// neither.
+type Clip struct {
+	Channel  string `json:"channel"`
+	Text     string `json:"text"`
+	Data     []byte `json:"data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Device   string `json:"device,omitempty"`
+
+	// Sensitive is set when the content looks like a secret.
+	Sensitive bool `json:"sensitive,omitempty"`
+
+	// User set the content, when authenticated by a trusted proxy.
+	User User `json:"user,omitzero"`
+
+	// Pinned is set while the content is kept past the TTL, until
+	// ExpiresAt.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// ExpiresAt is when the content will be cleared. It is zero when the
+	// channel is empty.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// Snippet is a named piece of text which, unlike the clipboard, is kept
+// until deleted.
+type Snippet struct {
+	Name   string `json:"name"`
+	Text   string `json:"text"`
+	Device string `json:"device,omitempty"`
+
+	// User saved the snippet, when authenticated by a trusted proxy.
+	User User `json:"user,omitzero"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Response is the body of every response of the versioned API: Data on
+// success, Error otherwise.
+type Response struct {
+	Data  any    `json:"data,omitempty"`
+	Error *Error `json:"error,omitempty"`
+}
+
+// Error describes a failed request of the versioned API.
+type Error struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// Capabilities listed in the discovery document.
+const (
+	CapabilityChannels    = "channels"
+	CapabilityFiles       = "files"
+	CapabilityEvents      = "events"
+	CapabilityQR          = "qr"
+	CapabilityPin         = "pin"
+	CapabilitySnippets    = "snippets"
+	CapabilityReplication = "replication"
+)
+
+// Discovery is served at /api, for clients to find the API versions and
+// features a server supports.
+type Discovery struct {
+	Versions     []Version `json:"versions"`
+	Capabilities []string  `json:"capabilities"`
+}
+
+// Version is a version of the API, served under URL.
+type Version struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+}
@@ -0,0 +1,592 @@
+// Package client is a Go client for the clipshare REST API.
+//
+//	c := client.New("http://localhost:8080", client.Options{Device: "laptop"})
+//	if err := c.Set(ctx, "hello world"); err != nil {
+//		return err
+//	}
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// Event is a change of the clipboard content, as delivered by Watch.
+type Event = api.Event
+
+// Snippet is a named piece of text kept by the server until deleted.
+type Snippet = api.Snippet
+
+// Content is the clipboard content as returned by GetContent.
+type Content struct {
+	Data []byte
+
+	// Filename is set when the content was uploaded as a file.
+	Filename string
+	MIMEType string
+}
+
+// Options configures a Client.
+type Options struct {
+	// Device is sent along with every set. Defaults to "cli".
+	Device string
+
+	// Channel selects the clipboard channel. Defaults to the server's
+	// default channel.
+	Channel string
+
+	// Token, if set, is sent as a bearer token, e.g. for servers behind an
+	// authenticating proxy.
+	Token string
+
+	// HTTPClient is used for all requests. Defaults to http.DefaultClient.
+	// Watch keeps its request open indefinitely, so a Timeout set here will
+	// also interrupt it; prefer Options.Timeout.
+	HTTPClient *http.Client
+
+	// Timeout bounds each Get, GetContent, Set and Clear call, retries
+	// included. Zero means no timeout. Watch is not affected.
+	Timeout time.Duration
+
+	// Retries is how many times idempotent requests (Get, GetContent and
+	// Clear) are retried after a temporary error, see IsTemporary.
+	Retries int
+
+	// RetryBackoff is the delay before the first retry. It doubles on every
+	// attempt, up to maxBackoff. Defaults to 250ms.
+	RetryBackoff time.Duration
+
+	// Passphrase, if set, encrypts everything the client sets, see the
+	// envelope package. Encrypted content is decrypted on the way back;
+	// content stored in the clear is returned as is.
+	Passphrase string
+}
+
+const (
+	defaultRetryBackoff = 250 * time.Millisecond
+	maxBackoff          = 5 * time.Second
+)
+
+// Client talks to a single clipshare server.
+type Client struct {
+	url          string
+	device       string
+	channel      string
+	token        string
+	httpClient   *http.Client
+	timeout      time.Duration
+	retries      int
+	retryBackoff time.Duration
+	passphrase   string
+}
+
+// New returns a Client for the server at url, e.g. "http://localhost:8080".
+func New(url string, opts Options) *Client {
+	if opts.Device == "" {
+		opts.Device = "cli"
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaultRetryBackoff
+	}
+
+	return &Client{
+		url:          strings.TrimSuffix(url, "/"),
+		device:       opts.Device,
+		channel:      opts.Channel,
+		token:        opts.Token,
+		httpClient:   opts.HTTPClient,
+		timeout:      opts.Timeout,
+		retries:      opts.Retries,
+		retryBackoff: opts.RetryBackoff,
+		passphrase:   opts.Passphrase,
+	}
+}
+
+// URL returns the server URL.
+func (c *Client) URL() string {
+	return c.url
+}
+
+// Channel returns the channel the client operates on; empty means the
+// server's default channel.
+func (c *Client) Channel() string {
+	return c.channel
+}
+
+// IsTemporary reports whether err may go away by retrying the request:
+// network timeouts, refused, reset and unreachable connections, connections
+// closed early, temporary DNS failures, and 429 and 5xx answers. Other
+// errors, such as TLS failures, invalid URLs and undecodable answers, are
+// permanent, and so are context errors.
+func IsTemporary(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	for _, target := range []error{
+		syscall.ECONNREFUSED, syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EPIPE,
+		syscall.ENETUNREACH, syscall.EHOSTUNREACH, syscall.ENETDOWN, syscall.ETIMEDOUT,
+		io.EOF, io.ErrUnexpectedEOF,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the current clipboard content.
+func (c *Client) Get(ctx context.Context) (string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, "/clipboard", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get clipboard: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	content, ok, err := c.open(string(body))
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		if content.isFile() {
+			return string(content.Data), nil
+		}
+		return content.Text, nil
+	}
+
+	return string(body), nil
+}
+
+// GetContent returns the current clipboard content along with its file name
+// and MIME type.
+func (c *Client) GetContent(ctx context.Context) (*Content, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, "/clipboard", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get clipboard: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	mimeType := resp.Header.Get("Content-Type")
+	// Drop parameters such as the charset of text.
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = mediaType
+	}
+
+	sealed, ok, err := c.open(string(data))
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if sealed.isFile() {
+			return &Content{Data: sealed.Data, Filename: sealed.Filename, MIMEType: sealed.MIMEType}, nil
+		}
+		return &Content{Data: []byte(sealed.Text), MIMEType: mimeType}, nil
+	}
+
+	content := &Content{Data: data, MIMEType: mimeType}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		content.Filename = params["filename"]
+	}
+	return content, nil
+}
+
+// Set replaces the clipboard content.
+func (c *Client) Set(ctx context.Context, text string) error {
+	return c.set(ctx, api.SetRequest{Text: text})
+}
+
+// SetFile replaces the clipboard content with a file.
+func (c *Client) SetFile(ctx context.Context, filename, mimeType string, data []byte) error {
+	return c.set(ctx, api.SetRequest{Data: data, Filename: filename, MIMEType: mimeType})
+}
+
+func (c *Client) set(ctx context.Context, req api.SetRequest) error {
+	req, err := c.Seal(req)
+	if err != nil {
+		return err
+	}
+	return c.post(ctx, req)
+}
+
+// post sends req as is, from the device of the client.
+func (c *Client) post(ctx context.Context, req api.SetRequest) error {
+	req.Device = c.device
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodPost, "/clipboard", jsonData)
+	if err != nil {
+		return fmt.Errorf("failed to set clipboard: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// Clear empties the clipboard.
+func (c *Client) Clear(ctx context.Context) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodDelete, "/clipboard", nil)
+	if err != nil {
+		return fmt.Errorf("failed to clear clipboard: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// Pin keeps the clipboard content for d instead of the server's TTL, until
+// it is replaced or unpinned. The server caps d, and uses its maximum pin
+// duration when d is zero. It returns when the content will be cleared.
+//
+// Pinning an empty clipboard fails with ErrNotFound, and pinning content
+// that looks like a secret with ErrConflict.
+func (c *Client) Pin(ctx context.Context, d time.Duration) (time.Time, error) {
+	path := "/api/v1/clipboard/pin"
+	if d > 0 {
+		path += "?duration=" + d.String()
+	}
+	return c.pin(ctx, http.MethodPost, path)
+}
+
+// Unpin lets the clipboard content expire after the server's TTL again,
+// counted from now. It returns when the content will be cleared.
+func (c *Client) Unpin(ctx context.Context) (time.Time, error) {
+	return c.pin(ctx, http.MethodDelete, "/api/v1/clipboard/pin")
+}
+
+func (c *Client) pin(ctx context.Context, method, path string) (time.Time, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, method, path, nil)
+	if err != nil {
+		if method == http.MethodPost {
+			return time.Time{}, fmt.Errorf("failed to pin clipboard: %w", err)
+		}
+		return time.Time{}, fmt.Errorf("failed to unpin clipboard: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var clip api.Clip
+	if err := json.NewDecoder(resp.Body).Decode(&api.Response{Data: &clip}); err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode clip: %w", err)
+	}
+	return clip.ExpiresAt, nil
+}
+
+// Channels returns the names of the channels holding content.
+func (c *Client) Channels(ctx context.Context) ([]string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, "/channels", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list channels: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var channels []string
+	if err := json.NewDecoder(resp.Body).Decode(&channels); err != nil {
+		return nil, fmt.Errorf("failed to decode channels: %w", err)
+	}
+	return channels, nil
+}
+
+// Snippets returns the snippets stored on the server, sorted by name.
+func (c *Client) Snippets(ctx context.Context) ([]Snippet, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, "/api/v1/snippets", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snippets: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var snippets []Snippet
+	if err := json.NewDecoder(resp.Body).Decode(&api.Response{Data: &snippets}); err != nil {
+		return nil, fmt.Errorf("failed to decode snippets: %w", err)
+	}
+	for i := range snippets {
+		if snippets[i], err = c.openSnippet(snippets[i]); err != nil {
+			return nil, err
+		}
+	}
+	return snippets, nil
+}
+
+// Snippet returns the snippet with the given name. Missing snippets fail
+// with ErrNotFound.
+func (c *Client) Snippet(ctx context.Context, name string) (Snippet, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, snippetPath(name), nil)
+	if err != nil {
+		return Snippet{}, fmt.Errorf("failed to get snippet: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var sn Snippet
+	if err := json.NewDecoder(resp.Body).Decode(&api.Response{Data: &sn}); err != nil {
+		return Snippet{}, fmt.Errorf("failed to decode snippet: %w", err)
+	}
+	return c.openSnippet(sn)
+}
+
+// PutSnippet creates or replaces the snippet with the given name. Unlike the
+// clipboard content, it never expires.
+func (c *Client) PutSnippet(ctx context.Context, name, text string) error {
+	req := api.SetRequest{Text: text, Device: c.device}
+	if c.passphrase != "" {
+		var err error
+		if req, err = c.seal(req); err != nil {
+			return err
+		}
+	}
+
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodPut, snippetPath(name), jsonData)
+	if err != nil {
+		return fmt.Errorf("failed to save snippet: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// DeleteSnippet deletes the snippet with the given name. Missing snippets
+// fail with ErrNotFound.
+func (c *Client) DeleteSnippet(ctx context.Context, name string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodDelete, snippetPath(name), nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete snippet: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func snippetPath(name string) string {
+	return "/api/v1/snippets/" + neturl.PathEscape(name)
+}
+
+// Discover returns the versions of the API and the capabilities of the
+// server, see api.Discovery.
+func (c *Client) Discover(ctx context.Context) (*api.Discovery, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := c.do(ctx, http.MethodGet, "/api", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover the API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var d api.Discovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery document: %w", err)
+	}
+	return &d, nil
+}
+
+// Watch calls fn for every clipboard change until ctx is canceled, the
+// server closes the stream or fn returns an error. The first event is always
+// an api.EventSnapshot with the current content.
+//
+// With a passphrase, encrypted content is decrypted before fn sees it, and
+// content that fails to decrypt ends the watch with an error.
+func (c *Client) Watch(ctx context.Context, fn func(Event) error) error {
+	resp, err := c.send(ctx, http.MethodGet, "/clipboard/events", nil)
+	if err != nil {
+		return fmt.Errorf("failed to watch clipboard: %w", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	var data strings.Builder
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read event stream: %w", err)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+
+			var ev Event
+			if err := json.Unmarshal([]byte(data.String()), &ev); err != nil {
+				return fmt.Errorf("failed to decode event: %w", err)
+			}
+			data.Reset()
+
+			if ev, err = c.openEvent(ev); err != nil {
+				return err
+			}
+			if err := fn(ev); err != nil {
+				return err
+			}
+
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// do sends a request, retrying idempotent ones on temporary errors with
+// exponential backoff.
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	retries := 0
+	if method == http.MethodGet || method == http.MethodDelete {
+		retries = c.retries
+	}
+
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, body)
+		if err == nil || attempt >= retries || !IsTemporary(err) {
+			return resp, err
+		}
+
+		// Jitter keeps retrying clients from synchronizing.
+		delay := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// send sends a single request and turns any non-200 answer into a
+// *StatusError.
+func (c *Client) send(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	if c.channel != "" {
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		path += sep + "channel=" + neturl.QueryEscape(c.channel)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       strings.TrimSpace(string(msg)),
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,463 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+	"github.com/aldur/clipshare/server"
+)
+
+func newTestClient(t *testing.T) (*Client, *server.Server) {
+	t.Helper()
+
+	srv := server.New(server.Options{})
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	return New(ts.URL, Options{Device: "test"}), srv
+}
+
+func TestSetGetClear(t *testing.T) {
+	c, srv := newTestClient(t)
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "hello world"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got := srv.Content(server.DefaultChannel); got != "hello world" {
+		t.Errorf("expected server content %q, got %q", "hello world", got)
+	}
+
+	text, err := c.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if text != "hello world" {
+		t.Errorf("expected %q, got %q", "hello world", text)
+	}
+
+	if err := c.Clear(ctx); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	text, err = c.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if text != "" {
+		t.Errorf("expected empty clipboard after Clear, got %q", text)
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	tests := []struct {
+		status   int
+		expected error
+	}{
+		{http.StatusBadRequest, ErrBadRequest},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusMethodNotAllowed, ErrMethodNotAllowed},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusBadGateway, ErrServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "nope", tt.status)
+			}))
+			defer ts.Close()
+
+			_, err := New(ts.URL, Options{}).Get(context.Background())
+
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("expected a *StatusError, got %T", err)
+			}
+			if statusErr.StatusCode != tt.status || statusErr.Body != "nope" {
+				t.Errorf("unexpected StatusError %+v", statusErr)
+			}
+		})
+	}
+}
+
+func TestCustomHTTPClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, Options{HTTPClient: &http.Client{Timeout: 10 * time.Millisecond}})
+
+	if _, err := c.Get(context.Background()); err == nil {
+		t.Error("expected the HTTP client timeout to apply")
+	}
+}
+
+func TestContextCanceled(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := c.Set(ctx, "never sent"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.Set(server.DefaultChannel, "before", "test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var events []Event
+	err := c.Watch(ctx, func(ev Event) error {
+		events = append(events, ev)
+
+		switch ev.Type {
+		case api.EventSnapshot:
+			go srv.Set(server.DefaultChannel, "after", "other")
+		case api.EventSet:
+			go srv.Clear(server.DefaultChannel)
+		case api.EventClear:
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	expected := []Event{
+		{Type: api.EventSnapshot, Channel: server.DefaultChannel, Text: "before", Device: "test", MIMEType: server.TextMIMEType},
+		{Type: api.EventSet, Channel: server.DefaultChannel, Text: "after", Device: "other", MIMEType: server.TextMIMEType},
+		{Type: api.EventClear, Channel: server.DefaultChannel},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events)
+	}
+	for i := range expected {
+		if (events[i].Type == api.EventClear) != events[i].ExpiresAt.IsZero() {
+			t.Errorf("event %d: unexpected expiry %v", i, events[i].ExpiresAt)
+		}
+		events[i].ExpiresAt = time.Time{}
+		if events[i] != expected[i] {
+			t.Errorf("event %d: expected %+v, got %+v", i, expected[i], events[i])
+		}
+	}
+}
+
+func TestWatchCallbackError(t *testing.T) {
+	c, _ := newTestClient(t)
+	stop := errors.New("stop")
+
+	err := c.Watch(context.Background(), func(ev Event) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("expected callback error, got %v", err)
+	}
+}
+
+func TestChannelAndToken(t *testing.T) {
+	srv := server.New(server.Options{})
+	var authorization string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, Options{Channel: "work", Token: "secret"})
+	if err := c.Set(context.Background(), "on work"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	if authorization != "Bearer secret" {
+		t.Errorf("expected bearer token, got %q", authorization)
+	}
+	if got := srv.Content("work"); got != "on work" {
+		t.Errorf("expected content on channel work, got %q", got)
+	}
+	if got := srv.Content(server.DefaultChannel); got != "" {
+		t.Errorf("expected default channel to be untouched, got %q", got)
+	}
+}
+
+func TestSetFileGetContent(t *testing.T) {
+	c, srv := newTestClient(t)
+	ctx := context.Background()
+
+	data := []byte{0x89, 'P', 'N', 'G', 0x00}
+	if err := c.SetFile(ctx, "screenshot.png", "image/png", data); err != nil {
+		t.Fatalf("SetFile failed: %v", err)
+	}
+
+	e, _ := srv.Get(server.DefaultChannel)
+	if e.Filename != "screenshot.png" || e.MIMEType != "image/png" || e.Device != "test" {
+		t.Errorf("unexpected server entry %+v", e)
+	}
+
+	content, err := c.GetContent(ctx)
+	if err != nil {
+		t.Fatalf("GetContent failed: %v", err)
+	}
+	if string(content.Data) != string(data) {
+		t.Errorf("expected %q, got %q", data, content.Data)
+	}
+	if content.Filename != "screenshot.png" || content.MIMEType != "image/png" {
+		t.Errorf("unexpected content metadata %+v", content)
+	}
+
+	if err := c.Set(ctx, "text"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	content, err = c.GetContent(ctx)
+	if err != nil {
+		t.Fatalf("GetContent failed: %v", err)
+	}
+	if content.MIMEType != server.TextMIMEType {
+		t.Errorf("expected MIME type %s without parameters, got %s", server.TextMIMEType, content.MIMEType)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var attempts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("finally"))
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, Options{Retries: 2, RetryBackoff: time.Millisecond})
+
+	text, err := c.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if text != "finally" || attempts != 3 {
+		t.Errorf("expected success on the third attempt, got %q after %d", text, attempts)
+	}
+
+	// Sets are not idempotent and are never retried.
+	attempts = 0
+	if err := c.Set(context.Background(), "once"); !errors.Is(err, ErrServer) {
+		t.Errorf("expected ErrServer, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected a single attempt for Set, got %d", attempts)
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	var attempts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "bad", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, Options{Retries: 3, RetryBackoff: time.Millisecond})
+
+	if err := c.Clear(context.Background()); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("expected ErrBadRequest, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected client errors not to be retried, got %d attempts", attempts)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, Options{Timeout: 20 * time.Millisecond, Retries: 5})
+
+	start := time.Now()
+	_, err := c.Get(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the timeout to bound retries, took %v", elapsed)
+	}
+}
+
+// timeoutError is a network timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTemporary(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{&neturl.Error{Op: "Post", URL: "http://x", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, true},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{&net.OpError{Op: "dial", Err: syscall.ENETUNREACH}, true},
+		{fmt.Errorf("failed to set clipboard: %w", &neturl.Error{Op: "Post", URL: "http://x", Err: io.EOF}), true},
+		{&net.DNSError{Err: "temporary failure in name resolution", IsTemporary: true}, true},
+		{&net.OpError{Op: "dial", Err: &timeoutError{}}, true},
+		{&StatusError{StatusCode: http.StatusBadGateway}, true},
+		{&StatusError{StatusCode: http.StatusInternalServerError}, true},
+		{&StatusError{StatusCode: http.StatusTooManyRequests}, true},
+
+		{&StatusError{StatusCode: http.StatusBadRequest}, false},
+		{&StatusError{StatusCode: http.StatusUnauthorized}, false},
+		{context.Canceled, false},
+		{fmt.Errorf("failed to get clipboard: %w", context.DeadlineExceeded), false},
+		{errors.New("connection refused"), false},
+		{&neturl.Error{Op: "Get", URL: "https://x", Err: x509.UnknownAuthorityError{}}, false},
+		{&neturl.Error{Op: "Get", URL: "https://x", Err: &tls.CertificateVerificationError{Err: errors.New("expired")}}, false},
+		{&neturl.Error{Op: "parse", URL: "::", Err: errors.New("missing protocol scheme")}, false},
+		{&net.DNSError{Err: "no such host", Name: "x", IsNotFound: true}, false},
+		{fmt.Errorf("failed to decode response: %w", &json.SyntaxError{}), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsTemporary(tt.err); got != tt.expected {
+			t.Errorf("IsTemporary(%v): expected %v, got %v", tt.err, tt.expected, got)
+		}
+	}
+}
+
+func TestChannels(t *testing.T) {
+	c, srv := newTestClient(t)
+	srv.Set("work", "a", "test")
+	srv.Set("home", "b", "test")
+
+	channels, err := c.Channels(context.Background())
+	if err != nil {
+		t.Fatalf("Channels failed: %v", err)
+	}
+	if strings.Join(channels, ",") != "home,work" {
+		t.Errorf("unexpected channels %v", channels)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	d, err := c.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(d.Versions) == 0 || d.Versions[0].Version != "v1" || d.Versions[0].URL != "/api/v1" {
+		t.Errorf("unexpected versions %+v", d.Versions)
+	}
+	if !slices.Contains(d.Capabilities, api.CapabilityFiles) {
+		t.Errorf("expected the files capability, got %v", d.Capabilities)
+	}
+}
+
+func TestPinUnpin(t *testing.T) {
+	srv := server.New(server.Options{TTL: time.Minute, MaxPinDuration: 2 * time.Hour})
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	c := New(ts.URL, Options{Channel: "work"})
+	ctx := context.Background()
+
+	if _, err := c.Pin(ctx, time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound on an empty clipboard, got %v", err)
+	}
+
+	srv.Set("work", "hello", "test")
+	until, err := c.Pin(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("Pin failed: %v", err)
+	}
+	if d := time.Until(until); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expected to be pinned for an hour, got until %v", until)
+	}
+	if until, _ = c.Pin(ctx, 0); time.Until(until) < 119*time.Minute {
+		t.Errorf("expected the maximum pin duration, got until %v", until)
+	}
+
+	until, err = c.Unpin(ctx)
+	if err != nil {
+		t.Fatalf("Unpin failed: %v", err)
+	}
+	if time.Until(until) > time.Minute {
+		t.Errorf("expected the TTL after unpinning, got until %v", until)
+	}
+
+	srv.Set("work", "token: ghp_"+strings.Repeat("aB3", 12), "test")
+	if _, err := c.Pin(ctx, time.Hour); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict for a secret, got %v", err)
+	}
+}
+
+func TestSnippets(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+
+	if _, err := c.Snippet(ctx, "standup"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := c.PutSnippet(ctx, "standup", "https://meet.example.com/standup"); err != nil {
+		t.Fatalf("PutSnippet failed: %v", err)
+	}
+	if err := c.PutSnippet(ctx, "account", "test@example.com"); err != nil {
+		t.Fatalf("PutSnippet failed: %v", err)
+	}
+
+	sn, err := c.Snippet(ctx, "standup")
+	if err != nil {
+		t.Fatalf("Snippet failed: %v", err)
+	}
+	if sn.Text != "https://meet.example.com/standup" || sn.Device != "test" || sn.UpdatedAt.IsZero() {
+		t.Errorf("unexpected snippet %+v", sn)
+	}
+
+	snippets, err := c.Snippets(ctx)
+	if err != nil {
+		t.Fatalf("Snippets failed: %v", err)
+	}
+	if len(snippets) != 2 || snippets[0].Name != "account" || snippets[1].Name != "standup" {
+		t.Errorf("unexpected snippets %+v", snippets)
+	}
+
+	if err := c.DeleteSnippet(ctx, "standup"); err != nil {
+		t.Fatalf("DeleteSnippet failed: %v", err)
+	}
+	if err := c.DeleteSnippet(ctx, "standup"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := c.PutSnippet(ctx, "a b", "hello"); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("expected ErrBadRequest for an invalid name, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Sentinel errors matched by StatusError, for use with errors.Is.
+var (
+	ErrBadRequest       = errors.New("bad request")
+	ErrNotFound         = errors.New("not found")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	ErrConflict         = errors.New("conflict")
+	ErrTooLarge         = errors.New("content too large")
+	ErrServer           = errors.New("server error")
+)
+
+// StatusError is returned when the server answers with an unexpected status
+// code.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Status)
+}
+
+func (e *StatusError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusMethodNotAllowed:
+		return ErrMethodNotAllowed
+	case e.StatusCode == http.StatusConflict:
+		return ErrConflict
+	case e.StatusCode == http.StatusRequestEntityTooLarge:
+		return ErrTooLarge
+	case e.StatusCode >= http.StatusInternalServerError:
+		return ErrServer
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aldur/clipshare/api"
+	"github.com/aldur/clipshare/envelope"
+)
+
+// sealedContent is the plaintext of encrypted content. Files are sealed with
+// their name and MIME type, so that the server doesn't learn those either.
+type sealedContent struct {
+	Text     string `json:"text,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+}
+
+func (s sealedContent) isFile() bool {
+	return s.MIMEType != ""
+}
+
+// Seal returns req with its content encrypted, as Set and SetFile send it,
+// or req itself when the client has no passphrase. Send it with SetEnvelope,
+// which doesn't encrypt it again.
+func (c *Client) Seal(req api.SetRequest) (api.SetRequest, error) {
+	if c.passphrase == "" {
+		return req, nil
+	}
+	return c.seal(req)
+}
+
+// SetEnvelope sets the clipboard to text already encrypted by Seal.
+func (c *Client) SetEnvelope(ctx context.Context, text string) error {
+	return c.post(ctx, api.SetRequest{Text: text})
+}
+
+// seal replaces req by a text request holding its encrypted content.
+func (c *Client) seal(req api.SetRequest) (api.SetRequest, error) {
+	content := sealedContent{Text: req.Text}
+	if req.IsFile() {
+		content = sealedContent{Data: req.Data, Filename: req.Filename, MIMEType: req.MIMEType}
+		if content.MIMEType == "" {
+			content.MIMEType = "application/octet-stream"
+		}
+	}
+
+	plaintext, err := json.Marshal(content)
+	if err != nil {
+		return api.SetRequest{}, err
+	}
+	sealed, err := envelope.Seal(plaintext, c.passphrase)
+	if err != nil {
+		return api.SetRequest{}, fmt.Errorf("failed to encrypt content: %w", err)
+	}
+	return api.SetRequest{Text: sealed, Device: req.Device}, nil
+}
+
+// open decrypts text if it is an envelope and the client has a passphrase.
+// It reports false for content stored in the clear.
+func (c *Client) open(text string) (sealedContent, bool, error) {
+	if c.passphrase == "" || !envelope.IsSealed(text) {
+		return sealedContent{}, false, nil
+	}
+
+	plaintext, err := envelope.Open(text, c.passphrase)
+	if err != nil {
+		return sealedContent{}, false, fmt.Errorf("failed to decrypt content: %w", err)
+	}
+
+	var content sealedContent
+	if err := json.Unmarshal(plaintext, &content); err != nil {
+		return sealedContent{}, false, fmt.Errorf("failed to decode decrypted content: %w", err)
+	}
+	return content, true, nil
+}
+
+// openSnippet decrypts the text of sn.
+func (c *Client) openSnippet(sn Snippet) (Snippet, error) {
+	content, ok, err := c.open(sn.Text)
+	if err != nil || !ok {
+		return sn, err
+	}
+	sn.Text = content.Text
+	return sn, nil
+}
+
+// openEvent decrypts the content carried by ev.
+func (c *Client) openEvent(ev Event) (Event, error) {
+	content, ok, err := c.open(ev.Text)
+	if err != nil || !ok {
+		return ev, err
+	}
+
+	if content.isFile() {
+		ev.Text = ""
+		ev.Filename = content.Filename
+		ev.MIMEType = content.MIMEType
+	} else {
+		ev.Text = content.Text
+	}
+	return ev, nil
+}
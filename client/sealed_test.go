@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aldur/clipshare/api"
+	"github.com/aldur/clipshare/envelope"
+	"github.com/aldur/clipshare/server"
+)
+
+func TestEncryption(t *testing.T) {
+	srv := server.New(server.Options{})
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+
+	c := New(ts.URL, Options{Device: "test", Passphrase: "secret"})
+	plain := New(ts.URL, Options{Device: "test"})
+	wrong := New(ts.URL, Options{Device: "test", Passphrase: "wrong"})
+
+	if err := c.Set(ctx, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	stored := srv.Content(server.DefaultChannel)
+	if !envelope.IsSealed(stored) || strings.Contains(stored, "hello") {
+		t.Fatalf("expected the server to store an envelope, got %q", stored)
+	}
+
+	if text, err := c.Get(ctx); err != nil || text != "hello" {
+		t.Errorf("expected decrypted text, got %q (%v)", text, err)
+	}
+	if text, _ := plain.Get(ctx); text != stored {
+		t.Errorf("expected the envelope without a passphrase, got %q", text)
+	}
+	if _, err := wrong.Get(ctx); !errors.Is(err, envelope.ErrWrongPassphrase) {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+
+	if err := c.SetFile(ctx, "report.pdf", "application/pdf", []byte("%PDF-1.7")); err != nil {
+		t.Fatal(err)
+	}
+	if stored := srv.Content(server.DefaultChannel); strings.Contains(stored, "report") {
+		t.Errorf("file name leaked into %q", stored)
+	}
+	content, err := c.GetContent(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content.Data) != "%PDF-1.7" || content.Filename != "report.pdf" || content.MIMEType != "application/pdf" {
+		t.Errorf("unexpected content %+v", content)
+	}
+
+	// Content set in the clear is passed through.
+	if err := plain.Set(ctx, "clear text"); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := c.Get(ctx); err != nil || text != "clear text" {
+		t.Errorf("expected clear text, got %q (%v)", text, err)
+	}
+}
+
+func TestWatchEncrypted(t *testing.T) {
+	srv := server.New(server.Options{})
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	c := New(ts.URL, Options{Device: "test", Passphrase: "secret"})
+
+	// No deadline: each event derives a key, which is slow under the race
+	// detector. The watch is cancelled once the last event is received.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var events []Event
+	err := c.Watch(ctx, func(ev Event) error {
+		events = append(events, ev)
+		switch len(events) {
+		case 1:
+			go c.Set(ctx, "sealed text")
+		case 2:
+			go c.SetFile(ctx, "shot.png", "image/png", []byte("\x89PNG"))
+		default:
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	if ev := events[1]; ev.Type != api.EventSet || ev.Text != "sealed text" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if ev := events[2]; ev.Text != "" || ev.Filename != "shot.png" || ev.MIMEType != "image/png" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}
+
+func TestSnippetsEncrypted(t *testing.T) {
+	srv := server.New(server.Options{})
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	ctx := context.Background()
+
+	c := New(ts.URL, Options{Device: "test", Passphrase: "secret"})
+	plain := New(ts.URL, Options{Device: "test"})
+
+	if err := c.PutSnippet(ctx, "account", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := plain.Snippet(ctx, "account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !envelope.IsSealed(stored.Text) || strings.Contains(stored.Text, "hunter2") {
+		t.Fatalf("expected the server to store an envelope, got %q", stored.Text)
+	}
+
+	if sn, err := c.Snippet(ctx, "account"); err != nil || sn.Text != "hunter2" {
+		t.Errorf("expected decrypted text, got %q (%v)", sn.Text, err)
+	}
+	if snippets, err := c.Snippets(ctx); err != nil || len(snippets) != 1 || snippets[0].Text != "hunter2" {
+		t.Errorf("expected decrypted snippets, got %+v (%v)", snippets, err)
+	}
+}
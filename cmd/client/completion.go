@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aldur/clipshare/client"
+)
+
+// completionTimeout bounds how long the shell waits for channel names.
+const completionTimeout = 2 * time.Second
+
+// completionScript returns the completion script for shell. The scripts call
+// back into `clipshare __complete` for profile, channel and snippet names.
+func completionScript(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletion, nil
+	case "zsh":
+		return zshCompletion, nil
+	case "fish":
+		return fishCompletion, nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q (want bash, zsh or fish)", shell)
+	}
+}
+
+// complete writes the completion candidates of the given kind to w, one per
+// line. words are the arguments typed so far: the global flags among them
+// select the profile and server that channels and snippets are listed from.
+func complete(w io.Writer, kind string, words []string) error {
+	fs := flag.NewFlagSet("__complete", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	registerGlobalFlags(fs)
+	// The command line is incomplete by definition, so keep whatever parsed.
+	fs.Parse(words)
+
+	var candidates []string
+	switch kind {
+	case "profiles":
+		path, err := configPath()
+		if err != nil {
+			return err
+		}
+		cfg, err := loadConfig(path)
+		if err != nil {
+			return err
+		}
+		candidates = cfg.profileNames()
+
+	case "channels", "snippets":
+		s, err := loadSettings()
+		if err != nil {
+			return err
+		}
+		s.options.Timeout = completionTimeout
+		s.options.Retries = 0
+		// Only names are listed, which are never encrypted.
+		s.options.Passphrase = ""
+		c := client.New(s.url, s.options)
+
+		if kind == "channels" {
+			candidates, err = c.Channels(context.Background())
+			if err != nil {
+				return err
+			}
+			break
+		}
+		snippets, err := c.Snippets(context.Background())
+		if err != nil {
+			return err
+		}
+		for _, sn := range snippets {
+			candidates = append(candidates, sn.Name)
+		}
+
+	default:
+		return fmt.Errorf("unknown completion %q", kind)
+	}
+
+	for _, c := range candidates {
+		fmt.Fprintln(w, c)
+	}
+	return nil
+}
+
+const bashCompletion = `# bash completion for clipshare
+
+_clipshare() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local words=("${COMP_WORDS[@]:1:COMP_CWORD-1}")
+    COMPREPLY=()
+
+    case "$prev" in
+        -p|-profile|--p|--profile)
+            COMPREPLY=($(compgen -W "$(clipshare __complete profiles 2>/dev/null)" -- "$cur"))
+            return
+            ;;
+        -c|-channel|--c|--channel)
+            COMPREPLY=($(compgen -W "$(clipshare __complete channels "${words[@]}" 2>/dev/null)" -- "$cur"))
+            return
+            ;;
+        -save)
+            COMPREPLY=($(compgen -W "$(clipshare __complete profiles 2>/dev/null)" -- "$cur"))
+            return
+            ;;
+        -u|-url|--u|--url|-d|-device|--d|--device|-timeout|--timeout|-retries|--retries|-wait)
+            return
+            ;;
+        -level)
+            COMPREPLY=($(compgen -W "L M Q H" -- "$cur"))
+            return
+            ;;
+        -spool|--spool|-o|-f)
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return
+            ;;
+    esac
+
+    local i cmd=""
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            -u|-url|--u|--url|-d|-device|--d|--device|-c|-channel|--c|--channel|-p|-profile|--p|--profile|-timeout|--timeout|-retries|--retries|-spool|--spool)
+                ((i++))
+                ;;
+            -*)
+                ;;
+            *)
+                cmd="${COMP_WORDS[i]}"
+                break
+                ;;
+        esac
+    done
+
+    case "$cmd" in
+        "")
+            if [[ "$cur" == -* ]]; then
+                COMPREPLY=($(compgen -W "-url -u -device -d -channel -c -profile -p -timeout -retries -spool" -- "$cur"))
+            else
+                COMPREPLY=($(compgen -W "get set clear pin unpin watch snip qr flush discover completion" -- "$cur"))
+            fi
+            ;;
+        get)
+            COMPREPLY=($(compgen -W "-o -force" -- "$cur"))
+            ;;
+        set)
+            if [[ "$cur" == -* ]]; then
+                COMPREPLY=($(compgen -W "-f" -- "$cur"))
+            fi
+            ;;
+        pin)
+            COMPREPLY=($(compgen -W "-for" -- "$cur"))
+            ;;
+        snip)
+            if ((COMP_CWORD == i + 1)); then
+                COMPREPLY=($(compgen -W "put get ls rm" -- "$cur"))
+            elif ((COMP_CWORD == i + 2)) && [[ "${COMP_WORDS[i+1]}" =~ ^(put|get|rm)$ ]]; then
+                COMPREPLY=($(compgen -W "$(clipshare __complete snippets "${words[@]}" 2>/dev/null)" -- "$cur"))
+            fi
+            ;;
+        qr)
+            if [[ "$cur" == -* ]]; then
+                COMPREPLY=($(compgen -W "-level -invert" -- "$cur"))
+            fi
+            ;;
+        discover)
+            COMPREPLY=($(compgen -W "-wait -save" -- "$cur"))
+            ;;
+        completion)
+            COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+            ;;
+    esac
+}
+
+complete -o default -F _clipshare clipshare
+`
+
+const zshCompletion = `#compdef clipshare
+
+_clipshare_profiles() {
+    local -a profiles
+    profiles=(${(f)"$(clipshare __complete profiles 2>/dev/null)"})
+    _describe -t profiles 'profile' profiles
+}
+
+_clipshare_channels() {
+    local -a channels
+    channels=(${(f)"$(clipshare __complete channels ${(Q)words[2,CURRENT-1]} 2>/dev/null)"})
+    _describe -t channels 'channel' channels
+}
+
+# Snippets are completed after "*::" has narrowed words to the arguments of
+# the command, so they get the full command line saved by _clipshare.
+_clipshare_snippets() {
+    local -a snippets
+    snippets=(${(f)"$(clipshare __complete snippets ${(Q)_clipshare_words} 2>/dev/null)"})
+    _describe -t snippets 'snippet' snippets
+}
+
+_clipshare() {
+    local curcontext="$curcontext" state line
+    typeset -A opt_args
+    local -a _clipshare_words
+    _clipshare_words=(${words[2,CURRENT-1]})
+
+    _arguments -C \
+        '(-url -u)'{-url,-u}'[server URL]:url:_urls' \
+        '(-device -d)'{-device,-d}'[device name]:device:' \
+        '(-channel -c)'{-channel,-c}'[clipboard channel]:channel:_clipshare_channels' \
+        '(-profile -p)'{-profile,-p}'[config profile]:profile:_clipshare_profiles' \
+        '-timeout[request timeout]:duration:' \
+        '-retries[retries for get and clear]:retries:' \
+        '-spool[directory where failed sets are queued]:directory:_files -/' \
+        '1:command:->command' \
+        '*::arg:->args'
+
+    case $state in
+        command)
+            local -a commands
+            commands=(
+                'get:get clipboard content'
+                'set:set clipboard content'
+                'clear:clear clipboard content'
+                'pin:keep clipboard content past the TTL'
+                'unpin:let clipboard content expire again'
+                'watch:print clipboard content on every change'
+                'snip:manage named snippets'
+                'qr:show clipboard content as a QR code'
+                'flush:send the sets queued in the spool directory'
+                'discover:list the servers advertised on the local network'
+                'completion:print a shell completion script'
+            )
+            _describe -t commands 'command' commands
+            ;;
+        args)
+            case $line[1] in
+                get)
+                    _arguments \
+                        '-o[write content to this file or directory]:path:_files' \
+                        '-force[overwrite the output file if it exists]'
+                    ;;
+                set)
+                    _arguments \
+                        '-f[upload this file]:file:_files' \
+                        '1:text:'
+                    ;;
+                pin)
+                    _arguments \
+                        '-for[how long to keep the content]:duration:'
+                    ;;
+                snip)
+                    _arguments \
+                        '1:action:(put get ls rm)' \
+                        '2:snippet:_clipshare_snippets'
+                    ;;
+                qr)
+                    _arguments \
+                        '-level[error correction level]:level:(L M Q H)' \
+                        '-invert[draw dark modules, for light backgrounds]' \
+                        '1:text:'
+                    ;;
+                discover)
+                    _arguments \
+                        '-wait[how long to wait for servers to answer]:duration:' \
+                        '-save[save the server URL into this profile]:profile:_clipshare_profiles' \
+                        '1:server:'
+                    ;;
+                completion)
+                    _values 'shell' bash zsh fish
+                    ;;
+            esac
+            ;;
+    esac
+}
+
+if [ "$funcstack[1]" = "_clipshare" ]; then
+    _clipshare "$@"
+else
+    compdef _clipshare clipshare
+fi
+`
+
+const fishCompletion = `# fish completion for clipshare
+
+# Prints the command, skipping global flags and their values.
+function __clipshare_command
+    set -l skip 0
+    for word in (commandline -opc)[2..-1]
+        if test $skip = 1
+            set skip 0
+            continue
+        end
+        switch $word
+            case -u -url --u --url -d -device --d --device -c -channel --c --channel -p -profile --p --profile -timeout --timeout -retries --retries -spool --spool
+                set skip 1
+            case '-*'
+            case '*'
+                echo $word
+                return 0
+        end
+    end
+    return 1
+end
+
+function __clipshare_using_command
+    set -l cmd (__clipshare_command)
+    and test "$cmd" = $argv[1]
+end
+
+function __clipshare_complete
+    clipshare __complete $argv[1] (commandline -opc)[2..-1] 2>/dev/null
+end
+
+set -l global 'not __clipshare_command'
+
+complete -c clipshare -n $global -f -a get -d 'Get clipboard content'
+complete -c clipshare -n $global -f -a set -d 'Set clipboard content'
+complete -c clipshare -n $global -f -a clear -d 'Clear clipboard content'
+complete -c clipshare -n $global -f -a pin -d 'Keep clipboard content past the TTL'
+complete -c clipshare -n $global -f -a unpin -d 'Let clipboard content expire again'
+complete -c clipshare -n $global -f -a watch -d 'Print clipboard content on every change'
+complete -c clipshare -n $global -f -a snip -d 'Manage named snippets'
+complete -c clipshare -n $global -f -a qr -d 'Show clipboard content as a QR code'
+complete -c clipshare -n $global -f -a flush -d 'Send the sets queued in the spool directory'
+complete -c clipshare -n $global -f -a discover -d 'List the servers advertised on the local network'
+complete -c clipshare -n $global -f -a completion -d 'Print a shell completion script'
+
+complete -c clipshare -n $global -o url -s u -x -d 'Server URL'
+complete -c clipshare -n $global -o device -s d -x -d 'Device name'
+complete -c clipshare -n $global -o channel -s c -x -a '(__clipshare_complete channels)' -d 'Clipboard channel'
+complete -c clipshare -n $global -o profile -s p -x -a '(__clipshare_complete profiles)' -d 'Config profile'
+complete -c clipshare -n $global -o timeout -x -d 'Request timeout'
+complete -c clipshare -n $global -o retries -x -d 'Retries for get and clear'
+complete -c clipshare -n $global -o spool -r -d 'Directory where failed sets are queued'
+
+complete -c clipshare -n '__clipshare_using_command get' -s o -r -d 'Write content to this file or directory'
+complete -c clipshare -n '__clipshare_using_command get' -o force -d 'Overwrite the output file if it exists'
+complete -c clipshare -n '__clipshare_using_command set' -s f -r -d 'Upload this file'
+complete -c clipshare -n '__clipshare_using_command pin' -f
+complete -c clipshare -n '__clipshare_using_command pin' -o for -x -d 'How long to keep the content'
+complete -c clipshare -n '__clipshare_using_command unpin' -f
+complete -c clipshare -n '__clipshare_using_command snip' -f
+complete -c clipshare -n '__clipshare_using_command snip; and not __fish_seen_subcommand_from put get ls rm' -a put -d 'Save a snippet'
+complete -c clipshare -n '__clipshare_using_command snip; and not __fish_seen_subcommand_from put get ls rm' -a get -d 'Print a snippet'
+complete -c clipshare -n '__clipshare_using_command snip; and not __fish_seen_subcommand_from put get ls rm' -a ls -d 'List snippets'
+complete -c clipshare -n '__clipshare_using_command snip; and not __fish_seen_subcommand_from put get ls rm' -a rm -d 'Delete a snippet'
+complete -c clipshare -n '__clipshare_using_command snip; and __fish_seen_subcommand_from put get rm' -a '(__clipshare_complete snippets)'
+complete -c clipshare -n '__clipshare_using_command qr' -f
+complete -c clipshare -n '__clipshare_using_command qr' -o level -x -a 'L M Q H' -d 'Error correction level'
+complete -c clipshare -n '__clipshare_using_command qr' -o invert -d 'Draw dark modules, for light backgrounds'
+complete -c clipshare -n '__clipshare_using_command discover' -f
+complete -c clipshare -n '__clipshare_using_command discover' -o wait -x -d 'How long to wait for servers to answer'
+complete -c clipshare -n '__clipshare_using_command discover' -o save -x -a '(__clipshare_complete profiles)' -d 'Save the server URL into this profile'
+complete -c clipshare -n '__clipshare_using_command completion' -x -a 'bash zsh fish'
+`
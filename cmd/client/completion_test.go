@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aldur/clipshare/client"
+	"github.com/aldur/clipshare/server"
+)
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		script, err := completionScript(shell)
+		if err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		for _, want := range []string{"__complete", "completion", "flush", "discover", "pin", "unpin", "snip", "snippets", "qr", "level", "-spool"} {
+			if !strings.Contains(script, want) {
+				t.Errorf("%s script is missing %q", shell, want)
+			}
+		}
+
+		// Channels and snippets come from the server picked on the command
+		// line, so it must be passed along.
+		for _, line := range strings.Split(script, "\n") {
+			if strings.Contains(line, "__complete channels 2>") || strings.Contains(line, "__complete snippets 2>") {
+				t.Errorf("%s script doesn't pass the command line: %s", shell, strings.TrimSpace(line))
+			}
+		}
+	}
+
+	if _, err := completionScript("tcsh"); err == nil {
+		t.Error("expected an error for an unsupported shell")
+	}
+}
+
+func TestCompleteProfiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "clipshare"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	config := "[work]\nurl = https://work\n\n[home]\nurl = http://home\n"
+	if err := os.WriteFile(filepath.Join(dir, "clipshare", "config"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := complete(&out, "profiles", nil); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if out.String() != "home\nwork\n" {
+		t.Errorf("unexpected profiles %q", out.String())
+	}
+}
+
+func TestCompleteChannels(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("CLIPSHARE_URL", "http://localhost:1")
+
+	srv := server.New(server.Options{})
+	srv.Set("team", "hello", "test")
+	srv.Set(server.DefaultChannel, "hello", "test")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	// The URL typed on the command line wins over the environment, and the
+	// trailing flag waiting for its value is ignored.
+	var out bytes.Buffer
+	if err := complete(&out, "channels", []string{"-url", ts.URL, "-c"}); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if out.String() != "default\nteam\n" {
+		t.Errorf("unexpected channels %q", out.String())
+	}
+
+	if err := client.New(ts.URL, client.Options{}).PutSnippet(context.Background(), "standup", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := complete(&out, "snippets", []string{"-url", ts.URL, "snip", "get"}); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if out.String() != "standup\n" {
+		t.Errorf("unexpected snippets %q", out.String())
+	}
+
+	if err := complete(&out, "commands", nil); err == nil {
+		t.Error("expected an error for an unknown completion")
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// profile is a named set of client settings from the config file.
+type profile struct {
+	URL       string
+	Device    string
+	Token     string
+	TokenFile string
+	Channel   string
+	CAFile    string
+	CertFile  string
+	KeyFile   string
+	Insecure  bool
+	Timeout   string
+	Retries   string
+	SpoolDir  string
+
+	Passphrase     string
+	PassphraseFile string
+}
+
+// config is the parsed client config file:
+//
+//	# Profile used when none is selected.
+//	default_profile = home
+//
+//	[home]
+//	url = http://100.64.0.1:8080
+//	device = laptop
+//
+//	[work]
+//	url = https://clipshare.example.com
+//	token_file = ~/.config/clipshare/work-token
+//	ca_file = /etc/ssl/certs/work-ca.pem
+//	channel = team
+//	timeout = 30s
+//	retries = 5
+//	spool_dir = ~/.local/state/clipshare/spool
+//	passphrase_file = ~/.config/clipshare/work-passphrase
+type config struct {
+	DefaultProfile string
+	Profiles       map[string]profile
+}
+
+// configPath returns $XDG_CONFIG_HOME/clipshare/config, falling back to
+// ~/.config when XDG_CONFIG_HOME is unset.
+func configPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "clipshare", "config"), nil
+}
+
+// loadConfig reads the config file at path. A missing file yields an empty
+// config.
+func loadConfig(path string) (*config, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &config{Profiles: map[string]profile{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config: %w", err)
+	}
+	defer f.Close()
+
+	cfg, err := parseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func parseConfig(r io.Reader) (*config, error) {
+	cfg := &config{Profiles: map[string]profile{}}
+
+	var section string
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed section header", lineNo)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section == "" {
+				return nil, fmt.Errorf("line %d: empty profile name", lineNo)
+			}
+			if _, ok := cfg.Profiles[section]; !ok {
+				cfg.Profiles[section] = profile{}
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key = strings.TrimSpace(key)
+		value = unquote(strings.TrimSpace(value))
+
+		if section == "" {
+			if key != "default_profile" {
+				return nil, fmt.Errorf("line %d: unknown key %q outside of a profile", lineNo, key)
+			}
+			cfg.DefaultProfile = value
+			continue
+		}
+
+		p := cfg.Profiles[section]
+		switch key {
+		case "url":
+			p.URL = value
+		case "device":
+			p.Device = value
+		case "token":
+			p.Token = value
+		case "token_file":
+			p.TokenFile = value
+		case "channel":
+			p.Channel = value
+		case "ca_file":
+			p.CAFile = value
+		case "cert_file":
+			p.CertFile = value
+		case "key_file":
+			p.KeyFile = value
+		case "insecure_skip_verify":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid boolean %q", lineNo, value)
+			}
+			p.Insecure = b
+		case "timeout":
+			if _, err := time.ParseDuration(value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid duration %q", lineNo, value)
+			}
+			p.Timeout = value
+		case "retries":
+			if n, err := strconv.Atoi(value); err != nil || n < 0 {
+				return nil, fmt.Errorf("line %d: invalid number of retries %q", lineNo, value)
+			}
+			p.Retries = value
+		case "spool_dir":
+			p.SpoolDir = value
+		case "passphrase":
+			p.Passphrase = value
+		case "passphrase_file":
+			p.PassphraseFile = value
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q", lineNo, key)
+		}
+		cfg.Profiles[section] = p
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if cfg.DefaultProfile != "" {
+		if _, ok := cfg.Profiles[cfg.DefaultProfile]; !ok {
+			return nil, fmt.Errorf("default_profile %q is not defined", cfg.DefaultProfile)
+		}
+	}
+
+	return cfg, nil
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		if s, err := strconv.Unquote(value); err == nil {
+			return s
+		}
+	}
+	return value
+}
+
+// saveProfileURL sets the url of the named profile in the config file at
+// path, creating the file or the profile if needed. Everything else in the
+// file is left as is.
+func saveProfileURL(path, name, url string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	// Refuse to write a file that wouldn't load.
+	if _, err := parseConfig(strings.NewReader(string(data))); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	urlLine := "url = " + url
+
+	section, header, urlAt := "", -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			if section == name && header < 0 {
+				header = i
+			}
+			continue
+		}
+		if key, _, ok := strings.Cut(trimmed, "="); ok && section == name && strings.TrimSpace(key) == "url" {
+			urlAt = i
+		}
+	}
+
+	switch {
+	case urlAt >= 0:
+		lines[urlAt] = urlLine
+	case header >= 0:
+		lines = slices.Insert(lines, header+1, urlLine)
+	default:
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+name+"]", urlLine)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// profile returns the profile called name. An empty name selects
+// default_profile, then a profile called "default", then no profile at all.
+func (c *config) profile(name string) (profile, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		return c.Profiles["default"], nil
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	return p, nil
+}
+
+// profileNames returns the names of all profiles, sorted.
+func (c *config) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// token returns the profile token, reading token_file if needed.
+func (p profile) token() (string, error) {
+	if p.Token != "" || p.TokenFile == "" {
+		return p.Token, nil
+	}
+
+	data, err := os.ReadFile(expandHome(p.TokenFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// passphrase returns the profile passphrase, reading passphrase_file if
+// needed. Only the trailing newline of the file is dropped: spaces may be
+// part of the passphrase.
+func (p profile) passphrase() (string, error) {
+	if p.Passphrase != "" || p.PassphraseFile == "" {
+		return p.Passphrase, nil
+	}
+
+	data, err := os.ReadFile(expandHome(p.PassphraseFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// httpClient returns an HTTP client honoring the profile TLS settings, or nil
+// when the defaults apply.
+func (p profile) httpClient() (*http.Client, error) {
+	if p.CAFile == "" && p.CertFile == "" && !p.Insecure {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: p.Insecure}
+
+	if p.CAFile != "" {
+		pem, err := os.ReadFile(expandHome(p.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", p.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if p.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(expandHome(p.CertFile), expandHome(p.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// firstNonEmpty implements the flags > env > profile > default precedence.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
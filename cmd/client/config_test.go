@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+# Selected when no profile is given.
+default_profile = home
+
+[home]
+url = http://100.64.0.1:8080
+device = laptop
+
+[work]
+url = "https://clipshare.example.com"
+token = secret
+channel = team
+insecure_skip_verify = true
+`
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+
+	if cfg.DefaultProfile != "home" {
+		t.Errorf("expected default profile %q, got %q", "home", cfg.DefaultProfile)
+	}
+
+	expected := map[string]profile{
+		"home": {URL: "http://100.64.0.1:8080", Device: "laptop"},
+		"work": {URL: "https://clipshare.example.com", Token: "secret", Channel: "team", Insecure: true},
+	}
+	for name, want := range expected {
+		if got := cfg.Profiles[name]; got != want {
+			t.Errorf("profile %s: expected %+v, got %+v", name, want, got)
+		}
+	}
+
+	if names := cfg.profileNames(); strings.Join(names, ",") != "home,work" {
+		t.Errorf("unexpected profile names %v", names)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unknown key", "[home]\ncolor = blue\n"},
+		{"key outside profile", "url = http://localhost\n"},
+		{"malformed section", "[home\n"},
+		{"missing equals", "[home]\nurl\n"},
+		{"invalid boolean", "[home]\ninsecure_skip_verify = maybe\n"},
+		{"undefined default", "default_profile = nope\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseConfig(strings.NewReader(tt.input)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestProfileSelection(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+
+	if p, _ := cfg.profile(""); p.Device != "laptop" {
+		t.Errorf("expected default_profile to be selected, got %+v", p)
+	}
+	if p, _ := cfg.profile("work"); p.Channel != "team" {
+		t.Errorf("expected work profile, got %+v", p)
+	}
+	if _, err := cfg.profile("missing"); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+
+	cfg, _ = parseConfig(strings.NewReader("[default]\ndevice = fallback\n"))
+	if p, _ := cfg.profile(""); p.Device != "fallback" {
+		t.Errorf("expected the default profile to be selected, got %+v", p)
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	cfg, err := loadConfig(filepath.Join(t.TempDir(), "config"))
+	if err != nil {
+		t.Fatalf("expected a missing config to be ignored, got %v", err)
+	}
+	if len(cfg.Profiles) != 0 {
+		t.Errorf("expected no profiles, got %v", cfg.Profiles)
+	}
+}
+
+func TestProfileTokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := profile{TokenFile: path}.token()
+	if err != nil {
+		t.Fatalf("token failed: %v", err)
+	}
+	if token != "from-file" {
+		t.Errorf("expected %q, got %q", "from-file", token)
+	}
+}
+
+func TestProfilePassphraseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(path, []byte(" two words \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	passphrase, err := profile{PassphraseFile: path}.passphrase()
+	if err != nil {
+		t.Fatalf("passphrase failed: %v", err)
+	}
+	if passphrase != " two words " {
+		t.Errorf("expected %q, got %q", " two words ", passphrase)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "clipshare"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "clipshare", "config"), []byte(testConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("CLIPSHARE_URL", "")
+	t.Setenv("CLIPSHARE_DEVICE", "env-device")
+	t.Setenv("CLIPSHARE_PROFILE", "")
+
+	path, err := configPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := cfg.profile("")
+
+	if got := firstNonEmpty("", os.Getenv("CLIPSHARE_URL"), p.URL, defaultURL); got != "http://100.64.0.1:8080" {
+		t.Errorf("expected profile URL, got %q", got)
+	}
+	if got := firstNonEmpty("", os.Getenv("CLIPSHARE_DEVICE"), p.Device, defaultDevice); got != "env-device" {
+		t.Errorf("expected env device, got %q", got)
+	}
+	if got := firstNonEmpty("flag-device", os.Getenv("CLIPSHARE_DEVICE"), p.Device, defaultDevice); got != "flag-device" {
+		t.Errorf("expected flag device, got %q", got)
+	}
+}
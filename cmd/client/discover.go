@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aldur/clipshare/discovery"
+)
+
+const defaultDiscoverWait = 2 * time.Second
+
+// discover lists the servers advertised on the local network. With a
+// profile name, it saves the URL of the server called instance, or of the
+// only server found, into that profile.
+func discover(wait time.Duration, profileName, instance string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	servers, err := discovery.Browse(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to discover servers: %w", err)
+	}
+
+	if instance != "" {
+		var matching []discovery.Server
+		for _, s := range servers {
+			if strings.EqualFold(s.Instance, instance) {
+				matching = append(matching, s)
+			}
+		}
+		servers = matching
+	}
+
+	if profileName == "" {
+		if len(servers) == 0 {
+			fmt.Fprintln(os.Stderr, "No servers found")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, s := range servers {
+			fmt.Fprintf(w, "%s\t%s\n", s.Instance, s.URL())
+		}
+		return w.Flush()
+	}
+
+	switch {
+	case len(servers) == 0 && instance != "":
+		return fmt.Errorf("server %q not found", instance)
+	case len(servers) == 0:
+		return fmt.Errorf("no servers found")
+	case len(servers) > 1:
+		return fmt.Errorf("found %d servers, name the one to save", len(servers))
+	}
+
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := saveProfileURL(path, profileName, servers[0].URL()); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Saved %s (%s) as profile %s in %s\n", servers[0].Instance, servers[0].URL(), profileName, path)
+	return nil
+}
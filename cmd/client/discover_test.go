@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveProfileURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clipshare", "config")
+
+	if err := saveProfileURL(path, "home", "http://192.168.1.10:8080"); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	existing := "# My servers\ndefault_profile = work\n\n[work]\nurl = https://old\ndevice = laptop\n\n[home]\ndevice = desk\n"
+	if err := os.WriteFile(path, []byte(existing), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveProfileURL(path, "work", "http://192.168.1.20:8080"); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := saveProfileURL(path, "home", "http://192.168.1.10:8080"); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := saveProfileURL(path, "lab", "http://192.168.1.30:8080"); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# My servers\ndefault_profile = work\n\n[work]\nurl = http://192.168.1.20:8080\ndevice = laptop\n\n" +
+		"[home]\nurl = http://192.168.1.10:8080\ndevice = desk\n\n[lab]\nurl = http://192.168.1.30:8080\n"
+	if string(data) != want {
+		t.Errorf("unexpected config:\n%s", data)
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("saved config doesn't load: %v", err)
+	}
+	if p, _ := cfg.profile("lab"); p.URL != "http://192.168.1.30:8080" {
+		t.Errorf("unexpected profile %+v", p)
+	}
+
+	if err := os.WriteFile(path, []byte("bogus"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveProfileURL(path, "home", "http://x"); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("expected an invalid config to be left alone, got %v", err)
+	}
+}
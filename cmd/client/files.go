@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/aldur/clipshare/client"
+)
+
+// readFile returns the name, detected MIME type and content of the file at
+// path.
+func readFile(path string) (string, string, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	name := filepath.Base(path)
+	return name, detectMIMEType(name, data), data, nil
+}
+
+// detectMIMEType prefers the type registered for the file extension and falls
+// back to sniffing the content.
+func detectMIMEType(name string, data []byte) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(name)); mimeType != "" {
+		return mimeType
+	}
+	return http.DetectContentType(data)
+}
+
+// writeOutput saves content to path. When path is a directory, the file name
+// sent by the server is used.
+func writeOutput(path string, content *client.Content, force bool) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		name := filepath.Base(content.Filename)
+		if content.Filename == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+			return fmt.Errorf("clipboard content has no file name, pass a file path to -o")
+		}
+		path = filepath.Join(path, name)
+	}
+
+	return writeFileAtomic(path, content.Data, force)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and moves it
+// into place, so that readers never observe a partial file. Existing files are
+// only replaced when force is set: otherwise the file is hard linked into
+// place, which fails if path was created in the meantime.
+func writeFileAtomic(path string, data []byte, force bool) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+
+	if !force {
+		if err := os.Link(tmp.Name(), path); errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%s already exists, use -force to overwrite it", path)
+		} else if err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+		return nil
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aldur/clipshare/client"
+)
+
+func TestDetectMIMEType(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"notes.txt", []byte("hello"), "text/plain; charset=utf-8"},
+		{"image.png", nil, "image/png"},
+		{"no-extension", []byte("%PDF-1.7"), "application/pdf"},
+		{"blob", []byte{0x00, 0x01, 0x02}, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectMIMEType(tt.name, tt.data); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+
+	if err := writeFileAtomic(path, []byte("first"), false); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	err := writeFileAtomic(path, []byte("second"), false)
+	if err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Errorf("expected a refusal to overwrite, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first" {
+		t.Errorf("file was modified without -force: %q", data)
+	}
+
+	if err := writeFileAtomic(path, []byte("second"), true); err != nil {
+		t.Fatalf("forced write failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "second" {
+		t.Errorf("expected %q, got %q", "second", data)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected temporary files to be cleaned up, got %v", entries)
+	}
+
+	// Links are not followed, even when their target doesn't exist.
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(filepath.Join(dir, "missing.txt"), link); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(link, []byte("third"), false); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Errorf("expected a refusal to overwrite the link, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("expected the link not to be followed")
+	}
+}
+
+func TestWriteOutputDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	content := &client.Content{Data: []byte("pdf"), Filename: "report.pdf"}
+	if err := writeOutput(dir, content, false); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "report.pdf")); string(data) != "pdf" {
+		t.Errorf("expected file to be written with its server name, got %q", data)
+	}
+
+	content = &client.Content{Data: []byte("text")}
+	if err := writeOutput(dir, content, false); err == nil {
+		t.Error("expected an error when content has no file name")
+	}
+
+	content = &client.Content{Data: []byte("evil"), Filename: "../evil"}
+	if err := writeOutput(dir, content, false); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); err != nil {
+		t.Errorf("expected the file name to be confined to the directory: %v", err)
+	}
+}
@@ -1,70 +1,183 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+	"github.com/aldur/clipshare/client"
+	"github.com/aldur/clipshare/qr"
 )
 
-type SetRequest struct {
-	Text   string `json:"text"`
-	Device string `json:"device"`
-}
+const (
+	defaultURL     = "http://localhost:8080"
+	defaultDevice  = "cli"
+	defaultTimeout = "10s"
+	defaultRetries = "2"
+)
 
 var (
-	url    string
-	device string
+	url         string
+	device      string
+	channel     string
+	profileName string
+	timeoutFlag string
+	retriesFlag string
+	spoolFlag   string
 )
 
-func get(url string) error {
-	resp, err := http.Get(url + "/clipboard")
+// settings are the resolved client settings.
+type settings struct {
+	url      string
+	options  client.Options
+	spoolDir string
+}
+
+// loadSettings resolves the client settings, giving precedence to flags, then
+// environment variables, then the selected config profile.
+func loadSettings() (*settings, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := cfg.profile(firstNonEmpty(profileName, os.Getenv("CLIPSHARE_PROFILE")))
 	if err != nil {
-		return fmt.Errorf("failed to get clipboard: %w", err)
+		return nil, err
+	}
+
+	token := os.Getenv("CLIPSHARE_TOKEN")
+	if token == "" {
+		if token, err = p.token(); err != nil {
+			return nil, err
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned %d: %s", resp.StatusCode, resp.Status)
+	passphrase := os.Getenv("CLIPSHARE_PASSPHRASE")
+	if passphrase == "" {
+		if passphrase, err = p.passphrase(); err != nil {
+			return nil, err
+		}
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	httpClient, err := p.httpClient()
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
-	fmt.Print(string(body))
-	return nil
+	timeout, err := time.ParseDuration(firstNonEmpty(timeoutFlag, os.Getenv("CLIPSHARE_TIMEOUT"), p.Timeout, defaultTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout: %w", err)
+	}
+
+	retries, err := strconv.Atoi(firstNonEmpty(retriesFlag, os.Getenv("CLIPSHARE_RETRIES"), p.Retries, defaultRetries))
+	if err != nil || retries < 0 {
+		return nil, fmt.Errorf("invalid number of retries")
+	}
+
+	return &settings{
+		url: firstNonEmpty(url, os.Getenv("CLIPSHARE_URL"), p.URL, defaultURL),
+		options: client.Options{
+			Device:     firstNonEmpty(device, os.Getenv("CLIPSHARE_DEVICE"), p.Device, defaultDevice),
+			Channel:    firstNonEmpty(channel, os.Getenv("CLIPSHARE_CHANNEL"), p.Channel),
+			Token:      token,
+			HTTPClient: httpClient,
+			Timeout:    timeout,
+			Retries:    retries,
+			Passphrase: passphrase,
+		},
+		spoolDir: expandHome(firstNonEmpty(spoolFlag, os.Getenv("CLIPSHARE_SPOOL"), p.SpoolDir)),
+	}, nil
 }
 
-func set(text, device, url string) error {
+// clientFor returns a client for the configured server using another
+// channel and device.
+func (s *settings) clientFor(channel, device string) *client.Client {
+	opts := s.options
+	opts.Channel = channel
+	opts.Device = device
+	return client.New(s.url, opts)
+}
+
+func get(c *client.Client, output string, force bool) error {
+	if output == "" {
+		text, err := c.Get(context.Background())
+		if err != nil {
+			return err
+		}
 
-	req := SetRequest{
-		Text:   text,
-		Device: device,
+		fmt.Print(text)
+		return nil
 	}
 
-	jsonData, err := json.Marshal(req)
+	content, err := c.GetContent(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return err
 	}
 
-	resp, err := http.Post(url+"/clipboard", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to set clipboard: %w", err)
+	return writeOutput(output, content, force)
+}
+
+// set sends req, queueing it in the spool when the server can't be reached.
+func set(s *settings, c *client.Client, sp *spool, req api.SetRequest) error {
+	err := sendSet(context.Background(), c, req)
+	if err == nil || sp == nil || !client.IsTemporary(err) {
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned %d: %s", resp.StatusCode, resp.Status)
+	// The spool is on disk, so content meant to be encrypted is only queued
+	// encrypted.
+	req, sealErr := c.Seal(req)
+	if sealErr != nil {
+		return sealErr
+	}
+	req.Device = s.options.Device
+	if err := sp.add(s.url, s.options.Channel, req, s.options.Passphrase != ""); err != nil {
+		return err
 	}
 
+	fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	fmt.Fprintf(os.Stderr, "Queued in %s, run `%s flush` to retry\n", sp.dir, os.Args[0])
 	return nil
 }
 
+// flush sends the queued sets, reporting what happened on stderr.
+func flush(s *settings, sp *spool) error {
+	sent, err := sp.flush(context.Background(), s.url, s.clientFor)
+	if sent > 0 {
+		fmt.Fprintf(os.Stderr, "Flushed %d queued set(s)\n", sent)
+	}
+	return err
+}
+
+func watch(c *client.Client) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := c.Watch(ctx, func(ev client.Event) error {
+		switch ev.Type {
+		case api.EventSnapshot, api.EventSet:
+			fmt.Println(ev.Text)
+		}
+		return nil
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
 func readStdin() (string, error) {
 	data, err := io.ReadAll(os.Stdin)
 	if err != nil {
@@ -87,12 +200,40 @@ func usage() {
 	flag.PrintDefaults()
 	fmt.Fprintf(os.Stderr, "\nCommands:\n")
 	fmt.Fprintf(os.Stderr, "  get                    - Get clipboard content\n")
+	fmt.Fprintf(os.Stderr, "  get -o <path> [-force] - Save clipboard content to a file\n")
 	fmt.Fprintf(os.Stderr, "  set <text>             - Set clipboard content\n")
 	fmt.Fprintf(os.Stderr, "  set                    - Set clipboard content from stdin (auto-detected)\n")
 	fmt.Fprintf(os.Stderr, "  set -                  - Set clipboard content from stdin (explicit)\n")
+	fmt.Fprintf(os.Stderr, "  set -f <path>          - Upload a file\n")
+	fmt.Fprintf(os.Stderr, "  clear                  - Clear clipboard content\n")
+	fmt.Fprintf(os.Stderr, "  pin [-for <duration>]  - Keep clipboard content past the TTL (default: server maximum)\n")
+	fmt.Fprintf(os.Stderr, "  unpin                  - Let clipboard content expire again\n")
+	fmt.Fprintf(os.Stderr, "  watch                  - Print clipboard content on every change\n")
+	fmt.Fprintf(os.Stderr, "  snip put <name> [text] - Save a snippet, from stdin without text or with -\n")
+	fmt.Fprintf(os.Stderr, "  snip get <name>        - Print a snippet\n")
+	fmt.Fprintf(os.Stderr, "  snip ls                - List snippets\n")
+	fmt.Fprintf(os.Stderr, "  snip rm <name>         - Delete a snippet\n")
+	fmt.Fprintf(os.Stderr, "  qr [text]              - Show clipboard content, or text, as a QR code\n")
+	fmt.Fprintf(os.Stderr, "  qr -level <L|M|Q|H>    - Pick the error correction level (default: M)\n")
+	fmt.Fprintf(os.Stderr, "  qr -invert             - Draw dark modules, for light-background terminals\n")
+	fmt.Fprintf(os.Stderr, "  flush                  - Send the sets queued in the spool directory\n")
+	fmt.Fprintf(os.Stderr, "  discover               - List the servers advertised on the local network\n")
+	fmt.Fprintf(os.Stderr, "  discover -save <name>  - Save the URL of a discovered server into a profile\n")
+	fmt.Fprintf(os.Stderr, "  completion <shell>     - Print a bash, zsh or fish completion script\n")
 	fmt.Fprintf(os.Stderr, "\nEnvironment variables:\n")
-	fmt.Fprintf(os.Stderr, "  CLIPSHARE_URL     - Server URL (default: http://localhost:8080)\n")
-	fmt.Fprintf(os.Stderr, "  CLIPSHARE_DEVICE  - Device name (default: cli)\n")
+	fmt.Fprintf(os.Stderr, "  CLIPSHARE_URL        - Server URL (default: http://localhost:8080)\n")
+	fmt.Fprintf(os.Stderr, "  CLIPSHARE_DEVICE     - Device name (default: cli)\n")
+	fmt.Fprintf(os.Stderr, "  CLIPSHARE_CHANNEL    - Clipboard channel (default: server default)\n")
+	fmt.Fprintf(os.Stderr, "  CLIPSHARE_TOKEN      - Bearer token sent to the server\n")
+	fmt.Fprintf(os.Stderr, "  CLIPSHARE_PROFILE    - Config profile\n")
+	fmt.Fprintf(os.Stderr, "  CLIPSHARE_TIMEOUT    - Request timeout (default: 10s)\n")
+	fmt.Fprintf(os.Stderr, "  CLIPSHARE_RETRIES    - Retries for get and clear (default: 2)\n")
+	fmt.Fprintf(os.Stderr, "  CLIPSHARE_SPOOL      - Directory where failed sets are queued\n")
+	fmt.Fprintf(os.Stderr, "  CLIPSHARE_PASSPHRASE - Encrypt content end to end with this passphrase\n")
+	fmt.Fprintf(os.Stderr, "\nConfiguration:\n")
+	fmt.Fprintf(os.Stderr, "  Profiles are read from $XDG_CONFIG_HOME/clipshare/config.\n")
+	fmt.Fprintf(os.Stderr, "  Flags take precedence over environment variables, which take\n")
+	fmt.Fprintf(os.Stderr, "  precedence over the selected profile.\n")
 	fmt.Fprintf(os.Stderr, "\nExamples:\n")
 	fmt.Fprintf(os.Stderr, "  %s get\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s set \"hello world\"\n", os.Args[0])
@@ -101,28 +242,41 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  echo \"hello world\" | %s set -\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  echo \"hello world\" | %s -device laptop set\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  %s -url http://example.com:8080 get\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s -profile work -channel team get\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s set -f report.pdf\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s get -o ~/Downloads/\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s pin -for 2h\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s snip put standup \"https://meet.example.com/standup\"\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s qr -level L \"https://example.com\"\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s discover -save home\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  source <(%s completion bash)\n", os.Args[0])
 	os.Exit(1)
 }
 
-func main() {
-	defaultURL := "http://localhost:8080"
-	if urlEnv := os.Getenv("CLIPSHARE_URL"); urlEnv != "" {
-		defaultURL = urlEnv
-	}
-	urlUsage := "Server URL"
-
-	defaultDevice := "cli"
-	if deviceEnv := os.Getenv("CLIPSHARE_DEVICE"); deviceEnv != "" {
-		defaultDevice = deviceEnv
-	}
-	deviceUsage := "Device name"
+// registerGlobalFlags defines the flags accepted before the command on fs.
+func registerGlobalFlags(fs *flag.FlagSet) {
+	urlUsage := "Server URL (default: " + defaultURL + ")"
+	deviceUsage := "Device name (default: " + defaultDevice + ")"
+	channelUsage := "Clipboard channel"
+	profileUsage := "Config profile"
 
 	shorthand := " (shorthand)"
 
-	flag.StringVar(&url, "url", defaultURL, urlUsage)
-	flag.StringVar(&url, "u", defaultURL, urlUsage+shorthand)
-	flag.StringVar(&device, "device", defaultDevice, deviceUsage)
-	flag.StringVar(&device, "d", defaultDevice, deviceUsage+shorthand)
+	fs.StringVar(&url, "url", "", urlUsage)
+	fs.StringVar(&url, "u", "", urlUsage+shorthand)
+	fs.StringVar(&device, "device", "", deviceUsage)
+	fs.StringVar(&device, "d", "", deviceUsage+shorthand)
+	fs.StringVar(&channel, "channel", "", channelUsage)
+	fs.StringVar(&channel, "c", "", channelUsage+shorthand)
+	fs.StringVar(&profileName, "profile", "", profileUsage)
+	fs.StringVar(&profileName, "p", "", profileUsage+shorthand)
+	fs.StringVar(&timeoutFlag, "timeout", "", "Request timeout (default: "+defaultTimeout+")")
+	fs.StringVar(&retriesFlag, "retries", "", "Retries for get and clear (default: "+defaultRetries+")")
+	fs.StringVar(&spoolFlag, "spool", "", "Directory where failed sets are queued (default: disabled)")
+}
+
+func main() {
+	registerGlobalFlags(flag.CommandLine)
 
 	flag.Usage = usage
 	flag.Parse()
@@ -133,41 +287,199 @@ func main() {
 
 	command := flag.Arg(0)
 
+	// These commands don't talk to the configured server, or only on their
+	// own terms, so they run before settings are resolved and the spool is
+	// flushed.
+	switch command {
+	case "completion":
+		if flag.NArg() != 2 {
+			usage()
+		}
+		script, err := completionScript(flag.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(script)
+		return
+
+	case "__complete":
+		if flag.NArg() < 2 {
+			os.Exit(1)
+		}
+		if err := complete(os.Stdout, flag.Arg(1), flag.Args()[2:]); err != nil {
+			os.Exit(1)
+		}
+		return
+
+	case "discover":
+		discoverFlags := flag.NewFlagSet("discover", flag.ExitOnError)
+		wait := discoverFlags.Duration("wait", defaultDiscoverWait, "How long to wait for servers to answer")
+		save := discoverFlags.String("save", "", "Save the server URL into this profile")
+		discoverFlags.Parse(flag.Args()[1:])
+
+		if err := discover(*wait, *save, discoverFlags.Arg(0)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	s, err := loadSettings()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	c := client.New(s.url, s.options)
+
+	var sp *spool
+	if s.spoolDir != "" {
+		sp = &spool{dir: s.spoolDir}
+
+		// Deliver queued sets before running the command, so that they can't
+		// overwrite newer content.
+		if command != "flush" {
+			if err := flush(s, sp); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to flush queued sets: %v\n", err)
+			}
+		}
+	}
+
 	switch command {
 	case "get":
-		if err := get(url); err != nil {
+		getFlags := flag.NewFlagSet("get", flag.ExitOnError)
+		output := getFlags.String("o", "", "Write content to this file (or into this directory)")
+		force := getFlags.Bool("force", false, "Overwrite the output file if it exists")
+		getFlags.Parse(flag.Args()[1:])
+
+		if err := get(c, *output, *force); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
 	case "set":
+		setFlags := flag.NewFlagSet("set", flag.ExitOnError)
+		file := setFlags.String("f", "", "Upload this file, preserving its name and MIME type")
+		setFlags.Parse(flag.Args()[1:])
+		args := setFlags.Args()
+
+		if *file != "" {
+			name, mimeType, data, err := readFile(*file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			req := api.SetRequest{Data: data, Filename: name, MIMEType: mimeType}
+			if err := set(s, c, sp, req); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			break
+		}
+
 		var text string
 		var err error
 
 		// Check if stdin has data available
-		if flag.NArg() < 2 && isStdinAvailable() {
+		if len(args) < 1 && isStdinAvailable() {
 			// Read from stdin when no arguments provided but stdin has data
 			text, err = readStdin()
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
-		} else if flag.NArg() >= 2 && flag.Arg(1) == "-" {
+		} else if len(args) >= 1 && args[0] == "-" {
 			// Explicit stdin read with "-"
 			text, err = readStdin()
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
-		} else if flag.NArg() >= 2 {
+		} else if len(args) >= 1 {
 			// Regular argument
-			text = flag.Arg(1)
+			text = args[0]
 		} else {
 			// No arguments and no stdin data
 			usage()
 		}
 
-		if err := set(text, device, url); err != nil {
+		if err := set(s, c, sp, api.SetRequest{Text: text}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "clear":
+		if err := c.Clear(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "pin":
+		pinFlags := flag.NewFlagSet("pin", flag.ExitOnError)
+		d := pinFlags.Duration("for", 0, "How long to keep the content (default: as long as the server allows)")
+		pinFlags.Parse(flag.Args()[1:])
+
+		if err := pin(os.Stdout, c, *d); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "unpin":
+		if err := unpin(os.Stdout, c); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "qr":
+		qrFlags := flag.NewFlagSet("qr", flag.ExitOnError)
+		levelFlag := qrFlags.String("level", "M", "Error correction level: L, M, Q or H")
+		invert := qrFlags.Bool("invert", false, "Draw dark modules, for terminals with a light background")
+		qrFlags.Parse(flag.Args()[1:])
+
+		level, err := qr.ParseLevel(*levelFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		var text string
+		if qrFlags.Arg(0) == "-" {
+			if text, err = readStdin(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			text = qrFlags.Arg(0)
+		}
+
+		if err := showQR(os.Stdout, c, text, level, *invert); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "flush":
+		if sp == nil {
+			fmt.Fprintf(os.Stderr, "Error: no spool directory configured\n")
+			os.Exit(1)
+		}
+		if err := flush(s, sp); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "snip":
+		err := snip(os.Stdout, c, flag.Args()[1:])
+		if errors.Is(err, errUsage) {
+			usage()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "watch":
+		if err := watch(c); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
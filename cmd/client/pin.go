@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aldur/clipshare/client"
+)
+
+// pinTimeFormat prints when pinned content is cleared, in local time.
+const pinTimeFormat = "Mon Jan 2 15:04"
+
+// pin keeps the clipboard content for d, or for as long as the server
+// allows if d is zero, and prints until when.
+func pin(w io.Writer, c *client.Client, d time.Duration) error {
+	until, err := c.Pin(context.Background(), d)
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		return fmt.Errorf("clipboard is empty")
+	case errors.Is(err, client.ErrConflict):
+		return fmt.Errorf("content that looks like a secret can't be pinned")
+	case err != nil:
+		return err
+	}
+
+	fmt.Fprintf(w, "Pinned until %s\n", until.Local().Format(pinTimeFormat))
+	return nil
+}
+
+// unpin lets the clipboard content expire again and prints when.
+func unpin(w io.Writer, c *client.Client) error {
+	until, err := c.Unpin(context.Background())
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		return fmt.Errorf("clipboard is empty")
+	case err != nil:
+		return err
+	}
+
+	fmt.Fprintf(w, "Expires at %s\n", until.Local().Format(pinTimeFormat))
+	return nil
+}
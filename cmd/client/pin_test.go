@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldur/clipshare/client"
+	"github.com/aldur/clipshare/server"
+)
+
+func TestPin(t *testing.T) {
+	srv := server.New(server.Options{TTL: time.Minute})
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	c := client.New(ts.URL, client.Options{})
+
+	var out bytes.Buffer
+	if err := pin(&out, c, time.Hour); err == nil || err.Error() != "clipboard is empty" {
+		t.Errorf("expected an empty clipboard error, got %v", err)
+	}
+
+	srv.Set(server.DefaultChannel, "hello", "test")
+	if err := pin(&out, c, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "Pinned until ") {
+		t.Errorf("expected when the pin ends, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := unpin(&out, c); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "Expires at ") {
+		t.Errorf("expected when the content expires, got %q", out.String())
+	}
+}
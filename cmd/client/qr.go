@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aldur/clipshare/client"
+	"github.com/aldur/clipshare/qr"
+)
+
+// showQR prints text, or the clipboard content if text is empty, as a QR
+// code.
+func showQR(w io.Writer, c *client.Client, text string, level qr.Level, invert bool) error {
+	if text == "" {
+		var err error
+		if text, err = c.Get(context.Background()); err != nil {
+			return err
+		}
+		if text == "" {
+			return fmt.Errorf("clipboard is empty")
+		}
+	}
+
+	code, err := qr.Encode([]byte(text), level)
+	if err != nil {
+		return err
+	}
+	return renderQR(w, code, invert)
+}
+
+// renderQR draws code with Unicode half blocks, two modules per character.
+//
+// Blocks are drawn in the terminal's foreground color. By default they stand
+// for light modules, which suits light text on a dark background; invert
+// draws the dark modules instead, for dark text on a light background.
+func renderQR(w io.Writer, code *qr.Code, invert bool) error {
+	side := code.Size + 2*qr.QuietZone
+
+	// filled reports whether the module at x, y is drawn, with the quiet
+	// zone included in the coordinates.
+	filled := func(x, y int) bool {
+		if y >= side {
+			return false
+		}
+		return code.Black(x-qr.QuietZone, y-qr.QuietZone) == invert
+	}
+
+	bw := bufio.NewWriter(w)
+	for y := 0; y < side; y += 2 {
+		for x := range side {
+			switch top, bottom := filled(x, y), filled(x, y+1); {
+			case top && bottom:
+				bw.WriteString("█")
+			case top:
+				bw.WriteString("▀")
+			case bottom:
+				bw.WriteString("▄")
+			default:
+				bw.WriteString(" ")
+			}
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
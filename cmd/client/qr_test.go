@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/aldur/clipshare/client"
+	"github.com/aldur/clipshare/qr"
+	"github.com/aldur/clipshare/server"
+)
+
+// parseHalfBlocks turns rendered half blocks back into rows of modules.
+func parseHalfBlocks(t *testing.T, out string) [][]bool {
+	t.Helper()
+
+	var rows [][]bool
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		top := make([]bool, 0, utf8.RuneCountInString(line))
+		bottom := make([]bool, 0, cap(top))
+		for _, r := range line {
+			switch r {
+			case '█':
+				top, bottom = append(top, true), append(bottom, true)
+			case '▀':
+				top, bottom = append(top, true), append(bottom, false)
+			case '▄':
+				top, bottom = append(top, false), append(bottom, true)
+			case ' ':
+				top, bottom = append(top, false), append(bottom, false)
+			default:
+				t.Fatalf("unexpected character %q", r)
+			}
+		}
+		rows = append(rows, top, bottom)
+	}
+	return rows
+}
+
+func TestRenderQR(t *testing.T) {
+	code, err := qr.Encode([]byte("https://example.com"), qr.M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	side := code.Size + 2*qr.QuietZone
+
+	for _, invert := range []bool{false, true} {
+		var out bytes.Buffer
+		if err := renderQR(&out, code, invert); err != nil {
+			t.Fatal(err)
+		}
+
+		rows := parseHalfBlocks(t, out.String())
+		// An odd number of rows leaves the bottom half of the last line empty.
+		if len(rows) != side+1 {
+			t.Fatalf("expected %d rows, got %d", side+1, len(rows))
+		}
+		for y, row := range rows[:side] {
+			if len(row) != side {
+				t.Fatalf("expected %d columns, got %d", side, len(row))
+			}
+			for x, filled := range row {
+				if want := code.Black(x-qr.QuietZone, y-qr.QuietZone) == invert; filled != want {
+					t.Fatalf("invert=%v: module (%d, %d) is %v, want %v", invert, x, y, filled, want)
+				}
+			}
+		}
+		for _, filled := range rows[side] {
+			if filled {
+				t.Fatalf("invert=%v: unexpected module below the code", invert)
+			}
+		}
+	}
+}
+
+func TestShowQR(t *testing.T) {
+	srv := server.New(server.Options{})
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	c := client.New(ts.URL, client.Options{})
+
+	if err := showQR(&bytes.Buffer{}, c, "", qr.M, false); err == nil {
+		t.Error("expected an error for an empty clipboard")
+	}
+
+	srv.Set(server.DefaultChannel, "from the clipboard", "test")
+	var got, want bytes.Buffer
+	if err := showQR(&got, c, "", qr.H, false); err != nil {
+		t.Fatal(err)
+	}
+	code, _ := qr.Encode([]byte("from the clipboard"), qr.H)
+	renderQR(&want, code, false)
+	if got.String() != want.String() {
+		t.Error("expected the QR code of the clipboard content")
+	}
+
+	got.Reset()
+	want.Reset()
+	if err := showQR(&got, c, "given", qr.L, true); err != nil {
+		t.Fatal(err)
+	}
+	code, _ = qr.Encode([]byte("given"), qr.L)
+	renderQR(&want, code, true)
+	if got.String() != want.String() {
+		t.Error("expected the QR code of the given text")
+	}
+
+	if err := showQR(&got, c, strings.Repeat("a", 3000), qr.L, false); err == nil {
+		t.Error("expected an error for text too long for a QR code")
+	}
+}
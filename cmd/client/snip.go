@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aldur/clipshare/client"
+)
+
+// errUsage reports a command line that doesn't match the usage.
+var errUsage = errors.New("invalid arguments")
+
+// snip runs the snippet commands: put <name> [text|-], get <name>, ls and
+// rm <name>. put reads the text from stdin when it is "-", or missing while
+// stdin has data.
+func snip(w io.Writer, c *client.Client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	ctx := context.Background()
+
+	switch action, args := args[0], args[1:]; {
+	case action == "put" && (len(args) == 1 || len(args) == 2):
+		var text string
+		var err error
+		switch {
+		case len(args) == 2 && args[1] != "-":
+			text = args[1]
+		case len(args) == 2 || isStdinAvailable():
+			if text, err = readStdin(); err != nil {
+				return err
+			}
+		default:
+			return errUsage
+		}
+		return snippetError(args[0], c.PutSnippet(ctx, args[0], text))
+
+	case action == "get" && len(args) == 1:
+		sn, err := c.Snippet(ctx, args[0])
+		if err != nil {
+			return snippetError(args[0], err)
+		}
+		fmt.Fprint(w, sn.Text)
+		return nil
+
+	case action == "ls" && len(args) == 0:
+		snippets, err := c.Snippets(ctx)
+		if err != nil {
+			return err
+		}
+		for _, sn := range snippets {
+			fmt.Fprintln(w, sn.Name)
+		}
+		return nil
+
+	case action == "rm" && len(args) == 1:
+		return snippetError(args[0], c.DeleteSnippet(ctx, args[0]))
+	}
+	return errUsage
+}
+
+// snippetError explains the errors caused by the name of a snippet.
+func snippetError(name string, err error) error {
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		return fmt.Errorf("no snippet named %q", name)
+	case errors.Is(err, client.ErrBadRequest):
+		return fmt.Errorf("invalid snippet name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aldur/clipshare/client"
+	"github.com/aldur/clipshare/server"
+)
+
+func TestSnip(t *testing.T) {
+	ts := httptest.NewServer(server.New(server.Options{}))
+	t.Cleanup(ts.Close)
+	c := client.New(ts.URL, client.Options{})
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := snip(&out, c, args)
+		return out.String(), err
+	}
+
+	if _, err := run("put", "standup", "https://meet.example.com/standup"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("put", "account", "test@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := run("get", "standup"); err != nil || out != "https://meet.example.com/standup" {
+		t.Errorf("expected the snippet, got %q (%v)", out, err)
+	}
+	if out, err := run("ls"); err != nil || out != "account\nstandup\n" {
+		t.Errorf("expected the snippet names, got %q (%v)", out, err)
+	}
+
+	if _, err := run("rm", "standup"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("get", "standup"); err == nil || err.Error() != `no snippet named "standup"` {
+		t.Errorf("expected a missing snippet error, got %v", err)
+	}
+
+	for _, args := range [][]string{nil, {"get"}, {"ls", "extra"}, {"rm"}, {"cp", "a", "b"}} {
+		if _, err := run(args...); !errors.Is(err, errUsage) {
+			t.Errorf("%q: expected a usage error, got %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+	"github.com/aldur/clipshare/client"
+)
+
+// spool is a directory of sets that failed with a temporary error, delivered
+// in order by flush.
+type spool struct {
+	dir string
+}
+
+// spooledSet is a queued set, along with where it was meant to go.
+type spooledSet struct {
+	URL      string         `json:"url"`
+	Channel  string         `json:"channel,omitempty"`
+	QueuedAt time.Time      `json:"queued_at"`
+	Request  api.SetRequest `json:"request"`
+	// Sealed is set when the text of Request is already encrypted, so that
+	// it is sent as is.
+	Sealed bool `json:"sealed,omitempty"`
+}
+
+// sendSet sends req, which is either text or a file.
+func sendSet(ctx context.Context, c *client.Client, req api.SetRequest) error {
+	if req.IsFile() {
+		return c.SetFile(ctx, req.Filename, req.MIMEType, req.Data)
+	}
+	return c.Set(ctx, req.Text)
+}
+
+// add queues req, which is sealed if its text is already encrypted. Entries
+// are named after the time they were queued so that they sort in order.
+func (sp *spool) add(url, channel string, req api.SetRequest, sealed bool) error {
+	if err := os.MkdirAll(sp.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	now := time.Now()
+	data, err := json.Marshal(spooledSet{URL: url, Channel: channel, QueuedAt: now, Request: req, Sealed: sealed})
+	if err != nil {
+		return err
+	}
+
+	// Write to a hidden file first, so that flush never reads a partial
+	// entry.
+	tmp, err := os.CreateTemp(sp.dir, ".queue-*")
+	if err != nil {
+		return fmt.Errorf("failed to queue set: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to queue set: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to queue set: %w", err)
+	}
+
+	name := fmt.Sprintf("%020d-%s.json", now.UnixNano(), strings.TrimPrefix(filepath.Base(tmp.Name()), ".queue-"))
+	if err := os.Rename(tmp.Name(), filepath.Join(sp.dir, name)); err != nil {
+		return fmt.Errorf("failed to queue set: %w", err)
+	}
+	return nil
+}
+
+// entries returns the queued entry paths, oldest first.
+func (sp *spool) entries() ([]string, error) {
+	dirEntries, err := os.ReadDir(sp.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, e := range dirEntries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") && strings.HasSuffix(e.Name(), ".json") {
+			paths = append(paths, filepath.Join(sp.dir, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// flush delivers the sets queued for the server at url, oldest first, and
+// returns how many were sent. It stops at the first temporary error, leaving
+// the remaining entries queued. Entries the server rejects are dropped.
+func (sp *spool) flush(ctx context.Context, url string, clientFor func(channel, device string) *client.Client) (int, error) {
+	paths, err := sp.entries()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return sent, err
+		}
+
+		var entry spooledSet
+		if err := json.Unmarshal(data, &entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: dropping unreadable queued set %s: %v\n", path, err)
+			os.Remove(path)
+			continue
+		}
+		if entry.URL != url {
+			continue
+		}
+
+		c := clientFor(entry.Channel, entry.Request.Device)
+		if entry.Sealed {
+			err = c.SetEnvelope(ctx, entry.Request.Text)
+		} else {
+			err = sendSet(ctx, c, entry.Request)
+		}
+		if client.IsTemporary(err) {
+			return sent, err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: dropping queued set from %s: %v\n", entry.QueuedAt.Format(time.RFC3339), err)
+		} else {
+			sent++
+		}
+
+		if err := os.Remove(path); err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/aldur/clipshare/api"
+	"github.com/aldur/clipshare/client"
+	"github.com/aldur/clipshare/server"
+)
+
+func TestSpoolFlush(t *testing.T) {
+	srv := server.New(server.Options{})
+	available := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	s := &settings{url: ts.URL}
+	sp := &spool{dir: t.TempDir()}
+
+	for _, text := range []string{"first", "second"} {
+		if err := sp.add(ts.URL, "", api.SetRequest{Text: text, Device: "phone"}, false); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+	}
+	if err := sp.add(ts.URL, "work", api.SetRequest{Data: []byte("%PDF"), Filename: "a.pdf", MIMEType: "application/pdf"}, false); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if err := sp.add("http://elsewhere:8080", "", api.SetRequest{Text: "other server"}, false); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	sent, err := sp.flush(context.Background(), s.url, s.clientFor)
+	if !client.IsTemporary(err) || sent != 0 {
+		t.Fatalf("expected a temporary error and nothing sent, got %d, %v", sent, err)
+	}
+	if paths, _ := sp.entries(); len(paths) != 4 {
+		t.Fatalf("expected all entries to stay queued, got %d", len(paths))
+	}
+
+	available = true
+	sent, err = sp.flush(context.Background(), s.url, s.clientFor)
+	if err != nil || sent != 3 {
+		t.Fatalf("expected 3 sets to be flushed, got %d, %v", sent, err)
+	}
+
+	if e, _ := srv.Get(server.DefaultChannel); string(e.Data) != "second" || e.Device != "phone" {
+		t.Errorf("expected the newest queued set to win, got %+v", e)
+	}
+	if e, _ := srv.Get("work"); e.Filename != "a.pdf" {
+		t.Errorf("expected the file to be sent to its channel, got %+v", e)
+	}
+
+	paths, _ := sp.entries()
+	if len(paths) != 1 {
+		t.Errorf("expected only the entry for another server to stay queued, got %v", paths)
+	}
+}
+
+func TestSpoolEncrypted(t *testing.T) {
+	srv := server.New(server.Options{})
+	available := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	s := &settings{url: ts.URL, options: client.Options{Device: "phone", Passphrase: "secret"}}
+	sp := &spool{dir: t.TempDir()}
+	c := client.New(s.url, s.options)
+
+	if err := set(s, c, sp, api.SetRequest{Text: "plaintext"}); err != nil {
+		t.Fatalf("expected the set to be queued, got %v", err)
+	}
+	paths, _ := sp.entries()
+	if len(paths) != 1 {
+		t.Fatalf("expected one queued set, got %v", paths)
+	}
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("plaintext")) {
+		t.Errorf("expected the queued set to be encrypted, got %s", data)
+	}
+
+	available = true
+	if sent, err := sp.flush(context.Background(), s.url, s.clientFor); err != nil || sent != 1 {
+		t.Fatalf("expected the set to be flushed, got %d, %v", sent, err)
+	}
+	// Encrypted once, not once more when flushed.
+	if text, err := c.Get(context.Background()); err != nil || text != "plaintext" {
+		t.Errorf("expected the queued text, got %q (%v)", text, err)
+	}
+	if e, _ := srv.Get(server.DefaultChannel); e.Device != "phone" {
+		t.Errorf("expected the device of the set, got %+v", e)
+	}
+}
+
+func TestSpoolDropsRejected(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+	}))
+	defer ts.Close()
+
+	s := &settings{url: ts.URL}
+	sp := &spool{dir: t.TempDir()}
+	if err := sp.add(ts.URL, "", api.SetRequest{Text: "huge"}, false); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+
+	sent, err := sp.flush(context.Background(), s.url, s.clientFor)
+	if err != nil || sent != 0 {
+		t.Errorf("expected the rejected entry to be dropped, got %d, %v", sent, err)
+	}
+	if paths, _ := sp.entries(); len(paths) != 0 {
+		t.Errorf("expected an empty spool, got %v", paths)
+	}
+}
+
+func TestSpoolMissingDirectory(t *testing.T) {
+	sp := &spool{dir: t.TempDir() + "/missing"}
+
+	sent, err := sp.flush(context.Background(), "http://localhost", nil)
+	if err != nil || sent != 0 {
+		t.Errorf("expected a missing spool to be empty, got %d, %v", sent, err)
+	}
+}
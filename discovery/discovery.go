@@ -0,0 +1,409 @@
+// Package discovery advertises and finds clipshare servers on the local
+// network with multicast DNS service discovery (RFC 6762 and RFC 6763).
+//
+// Servers are advertised as instances of the _clipshare._tcp service:
+//
+//	go discovery.Advertise(ctx, discovery.Service{Instance: "office", Port: 8080})
+//
+// and clients find them with Browse:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+//	defer cancel()
+//	servers, err := discovery.Browse(ctx)
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServiceType is the DNS-SD service type of clipshare servers.
+const ServiceType = "_clipshare._tcp.local."
+
+const (
+	mdnsPort = 5353
+
+	// recordTTL is the TTL of advertised records, in seconds.
+	recordTTL = 120
+	// legacyTTL caps TTLs in replies to one-shot queries, see RFC 6762
+	// section 6.7.
+	legacyTTL = 10
+
+	// queryInterval is how long Browse waits before repeating its query.
+	// The interval doubles on each repeat.
+	queryInterval = 250 * time.Millisecond
+
+	maxPacketSize = 9000
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+
+// Service is an advertised server.
+type Service struct {
+	// Instance is the user-visible name of the server. Defaults to the host
+	// name.
+	Instance string
+
+	// Host is the name the server's addresses are published under, in the
+	// .local domain. Defaults to the host name.
+	Host string
+
+	Port int
+
+	// IPs are the advertised addresses. Defaults to the IPv4 addresses of
+	// all interfaces except loopback.
+	IPs []net.IP
+
+	// TXT holds key=value pairs published along with the service.
+	TXT []string
+}
+
+func (s *Service) instanceName() string {
+	// Dots would split the instance into several labels.
+	return strings.ReplaceAll(s.Instance, ".", "-") + "." + ServiceType
+}
+
+func (s *Service) hostName() string {
+	return strings.ReplaceAll(s.Host, ".", "-") + ".local."
+}
+
+// records returns the PTR, SRV, TXT and address records describing s.
+func (s *Service) records(ttl uint32) (ptr, srv, txt record, addrs []record) {
+	ptr = record{name: ServiceType, rtype: typePTR, class: classIN, ttl: ttl, target: s.instanceName()}
+	srv = record{name: s.instanceName(), rtype: typeSRV, class: classIN, ttl: ttl, port: uint16(s.Port), target: s.hostName()}
+	txt = record{name: s.instanceName(), rtype: typeTXT, class: classIN, ttl: ttl, txt: s.TXT}
+	for _, ip := range s.IPs {
+		rtype := uint16(typeAAAA)
+		if ip.To4() != nil {
+			rtype = typeA
+		}
+		addrs = append(addrs, record{name: s.hostName(), rtype: rtype, class: classIN, ttl: ttl, ip: ip})
+	}
+	return ptr, srv, txt, addrs
+}
+
+// announcement is an unsolicited response publishing every record. A zero
+// ttl withdraws them.
+func (s *Service) announcement(ttl uint32) *message {
+	ptr, srv, txt, addrs := s.records(ttl)
+	m := &message{flags: flagResponse | flagAuthoritative, answers: []record{ptr, srv, txt}}
+	m.answers = append(m.answers, addrs...)
+	return m
+}
+
+// respond returns the response to query, or nil if s doesn't answer any of
+// its questions. Legacy queries, sent from a port other than 5353, get a
+// reply that echoes the query, as expected by one-shot resolvers.
+func (s *Service) respond(query *message, legacy bool) *message {
+	if query.isResponse() {
+		return nil
+	}
+
+	ttl := uint32(recordTTL)
+	if legacy {
+		ttl = legacyTTL
+	}
+	ptr, srv, txt, addrs := s.records(ttl)
+
+	resp := &message{flags: flagResponse | flagAuthoritative}
+	for _, q := range query.questions {
+		if q.class&classMask != classIN && q.class&classMask != typeANY {
+			continue
+		}
+		match := func(name string, types ...uint16) bool {
+			return strings.EqualFold(q.name, name) && (q.qtype == typeANY || slices.Contains(types, q.qtype))
+		}
+
+		switch {
+		case match(ServiceType, typePTR):
+			resp.answers = append(resp.answers, ptr)
+			resp.extra = append(resp.extra, srv, txt)
+			resp.extra = append(resp.extra, addrs...)
+		case match(s.instanceName(), typeSRV, typeTXT):
+			if q.qtype != typeTXT {
+				resp.answers = append(resp.answers, srv)
+			}
+			if q.qtype != typeSRV {
+				resp.answers = append(resp.answers, txt)
+			}
+			resp.extra = append(resp.extra, addrs...)
+		case match(s.hostName(), typeA, typeAAAA):
+			for _, r := range addrs {
+				if q.qtype == typeANY || q.qtype == r.rtype {
+					resp.answers = append(resp.answers, r)
+				}
+			}
+		}
+	}
+	if len(resp.answers) == 0 {
+		return nil
+	}
+
+	if legacy {
+		resp.id = query.id
+		resp.questions = query.questions
+	} else {
+		for _, rs := range [][]record{resp.answers, resp.extra} {
+			for i := range rs {
+				if rs[i].rtype != typePTR {
+					rs[i].class |= cacheFlush
+				}
+			}
+		}
+	}
+	return resp
+}
+
+// Advertise announces s on the local network and answers queries for it
+// until ctx is done, when the announcement is withdrawn.
+func Advertise(ctx context.Context, s Service) error {
+	if s.Instance == "" || s.Host == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		host, _, _ = strings.Cut(host, ".")
+		if s.Instance == "" {
+			s.Instance = host
+		}
+		if s.Host == "" {
+			s.Host = host
+		}
+	}
+	if len(s.IPs) == 0 {
+		ips, err := interfaceIPs()
+		if err != nil {
+			return err
+		}
+		s.IPs = ips
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return fmt.Errorf("failed to listen for mDNS queries: %w", err)
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.WriteToUDP(s.announcement(0).pack(), mdnsGroup)
+		conn.Close()
+	})
+	defer stop()
+
+	// Announce twice, a second apart, as recommended by RFC 6762 section 8.3.
+	conn.WriteToUDP(s.announcement(recordTTL).pack(), mdnsGroup)
+	time.AfterFunc(time.Second, func() {
+		if ctx.Err() == nil {
+			conn.WriteToUDP(s.announcement(recordTTL).pack(), mdnsGroup)
+		}
+	})
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		query, err := parseMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		legacy := src.Port != mdnsPort
+		resp := s.respond(query, legacy)
+		if resp == nil {
+			continue
+		}
+
+		dst := mdnsGroup
+		if legacy || unicastRequested(query) {
+			dst = src
+		}
+		conn.WriteToUDP(resp.pack(), dst)
+	}
+}
+
+// unicastRequested reports whether every question asks for a unicast reply.
+func unicastRequested(query *message) bool {
+	for _, q := range query.questions {
+		if q.class&^classMask == 0 {
+			return false
+		}
+	}
+	return len(query.questions) > 0
+}
+
+// interfaceIPs returns the IPv4 addresses of the interfaces that are up,
+// except loopback.
+func interfaceIPs() ([]net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				ips = append(ips, ipnet.IP.To4())
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("no network addresses to advertise")
+	}
+	return ips, nil
+}
+
+// Server is a server found by Browse.
+type Server struct {
+	// Instance is the name the server is advertised under.
+	Instance string
+	Host     string
+	Port     int
+	IPs      []net.IP
+	TXT      []string
+}
+
+// URL returns the base URL of the server, preferring IPv4 addresses.
+func (s Server) URL() string {
+	host := s.Host
+	for _, ip := range s.IPs {
+		host = ip.String()
+		if ip.To4() != nil {
+			break
+		}
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(s.Port))
+}
+
+// Browse asks the local network for clipshare servers and collects the
+// answers until ctx is done, so ctx should have a deadline.
+func Browse(ctx context.Context) ([]Server, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	query := &message{
+		id:        uint16(rand.N(1 << 16)),
+		questions: []question{{name: ServiceType, qtype: typePTR, class: classIN}},
+	}
+	if _, err := conn.WriteToUDP(query.pack(), mdnsGroup); err != nil {
+		return nil, fmt.Errorf("failed to send mDNS query: %w", err)
+	}
+
+	// Repeat the query with an increasing interval, in case it was lost.
+	go func() {
+		for interval := queryInterval; ; interval *= 2 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+				conn.WriteToUDP(query.pack(), mdnsGroup)
+			}
+		}
+	}()
+
+	found := map[string]Server{}
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return nil, err
+		}
+
+		resp, err := parseMessage(buf[:n])
+		if err != nil || !resp.isResponse() {
+			continue
+		}
+		for _, s := range serversIn(resp, src.IP) {
+			found[s.Instance] = s
+		}
+	}
+
+	servers := make([]Server, 0, len(found))
+	for _, s := range found {
+		servers = append(servers, s)
+	}
+	slices.SortFunc(servers, func(a, b Server) int { return strings.Compare(a.Instance, b.Instance) })
+	return servers, nil
+}
+
+// serversIn returns the servers described by resp. Servers without address
+// records are assumed to live at src, the address resp came from.
+func serversIn(resp *message, src net.IP) []Server {
+	records := append(slices.Clone(resp.answers), resp.extra...)
+
+	srvs := map[string]record{}
+	txts := map[string][]string{}
+	addrs := map[string][]net.IP{}
+	for _, r := range records {
+		name := strings.ToLower(r.name)
+		switch r.rtype {
+		case typeSRV:
+			srvs[name] = r
+		case typeTXT:
+			txts[name] = r.txt
+		case typeA, typeAAAA:
+			if r.ip != nil {
+				addrs[name] = append(addrs[name], r.ip)
+			}
+		}
+	}
+
+	var servers []Server
+	for _, r := range records {
+		if r.rtype != typePTR || !strings.EqualFold(r.name, ServiceType) || r.ttl == 0 {
+			continue
+		}
+		instance := strings.ToLower(r.target)
+		label, ok := strings.CutSuffix(instance, "."+ServiceType)
+		if !ok {
+			continue
+		}
+		srv, ok := srvs[instance]
+		if !ok {
+			continue
+		}
+
+		s := Server{
+			Instance: r.target[:len(label)],
+			Host:     strings.TrimSuffix(srv.target, "."),
+			Port:     int(srv.port),
+			IPs:      addrs[strings.ToLower(srv.target)],
+			TXT:      txts[instance],
+		}
+		if len(s.IPs) == 0 && src != nil {
+			s.IPs = []net.IP{src}
+		}
+		servers = append(servers, s)
+	}
+	return servers
+}
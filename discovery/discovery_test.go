@@ -0,0 +1,189 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testService = Service{
+	Instance: "office",
+	Host:     "desk",
+	Port:     8080,
+	IPs:      []net.IP{net.IPv4(192, 168, 1, 10)},
+	TXT:      []string{"path=/"},
+}
+
+func ptrQuery() *message {
+	return &message{
+		id:        42,
+		questions: []question{{name: ServiceType, qtype: typePTR, class: classIN}},
+	}
+}
+
+func TestPackParse(t *testing.T) {
+	s := testService
+	m := s.announcement(recordTTL)
+	m.questions = ptrQuery().questions
+
+	parsed, err := parseMessage(m.pack())
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if !parsed.isResponse() || len(parsed.questions) != 1 || len(parsed.answers) != 4 {
+		t.Fatalf("unexpected message %+v", parsed)
+	}
+
+	ptr, srv, txt, a := parsed.answers[0], parsed.answers[1], parsed.answers[2], parsed.answers[3]
+	if ptr.target != "office._clipshare._tcp.local." {
+		t.Errorf("unexpected PTR target %q", ptr.target)
+	}
+	if srv.port != 8080 || srv.target != "desk.local." {
+		t.Errorf("unexpected SRV %+v", srv)
+	}
+	if !slices.Equal(txt.txt, []string{"path=/"}) {
+		t.Errorf("unexpected TXT %q", txt.txt)
+	}
+	if !a.ip.Equal(net.IPv4(192, 168, 1, 10)) || a.ttl != recordTTL {
+		t.Errorf("unexpected A %+v", a)
+	}
+}
+
+func TestParseCompressed(t *testing.T) {
+	// A PTR answer whose target points back into the question.
+	b := (&message{flags: flagResponse, questions: ptrQuery().questions}).pack()
+	b[7] = 1                // One answer.
+	b = append(b, 0xc0, 12) // Name: pointer to the question name.
+	b = append(b, 0, typePTR, 0, classIN, 0, 0, 0, 120, 0, 8)
+	b = append(b, 6, 'o', 'f', 'f', 'i', 'c', 'e', 0xc0, 12)
+
+	m, err := parseMessage(b)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if r := m.answers[0]; r.name != ServiceType || r.target != "office."+ServiceType {
+		t.Errorf("unexpected record %+v", r)
+	}
+
+	// Pointers must go backwards.
+	loop := append(b[:12:12], 0xc0, 12)
+	loop[5] = 1
+	if _, err := parseMessage(loop); err == nil {
+		t.Error("expected a pointer loop to be rejected")
+	}
+
+	if _, err := parseMessage(b[:len(b)-3]); err == nil {
+		t.Error("expected a truncated message to be rejected")
+	}
+}
+
+func TestRespond(t *testing.T) {
+	s := testService
+
+	resp := s.respond(ptrQuery(), false)
+	if resp == nil {
+		t.Fatal("expected a response to a PTR query")
+	}
+	if resp.id != 0 || len(resp.questions) != 0 {
+		t.Errorf("multicast responses should not echo the query, got %+v", resp)
+	}
+	if len(resp.answers) != 1 || len(resp.extra) != 3 {
+		t.Errorf("expected the PTR answer with SRV, TXT and A records, got %+v", resp)
+	}
+	if resp.extra[0].class != classIN|cacheFlush {
+		t.Errorf("expected unique records to flush caches, got class %#x", resp.extra[0].class)
+	}
+
+	legacy := s.respond(ptrQuery(), true)
+	if legacy.id != 42 || len(legacy.questions) != 1 || legacy.answers[0].ttl != legacyTTL {
+		t.Errorf("expected legacy responses to echo the query, got %+v", legacy)
+	}
+
+	srvQuery := &message{questions: []question{{name: "OFFICE._clipshare._tcp.local.", qtype: typeSRV, class: classIN}}}
+	if resp := s.respond(srvQuery, false); resp == nil || len(resp.answers) != 1 || resp.answers[0].rtype != typeSRV {
+		t.Errorf("expected a case-insensitive SRV answer, got %+v", resp)
+	}
+
+	for _, q := range []question{
+		{name: "_http._tcp.local.", qtype: typePTR, class: classIN},
+		{name: ServiceType, qtype: typeA, class: classIN},
+	} {
+		if resp := s.respond(&message{questions: []question{q}}, false); resp != nil {
+			t.Errorf("expected no response to %+v, got %+v", q, resp)
+		}
+	}
+
+	if resp := s.respond(s.announcement(recordTTL), false); resp != nil {
+		t.Error("responses should be ignored")
+	}
+}
+
+func TestServersIn(t *testing.T) {
+	s := testService
+	resp := s.respond(ptrQuery(), false)
+
+	parsed, err := parseMessage(resp.pack())
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	servers := serversIn(parsed, net.IPv4(10, 0, 0, 1))
+	if len(servers) != 1 {
+		t.Fatalf("expected one server, got %+v", servers)
+	}
+	got := servers[0]
+	if got.Instance != "office" || got.Host != "desk.local" || got.Port != 8080 {
+		t.Errorf("unexpected server %+v", got)
+	}
+	if got.URL() != "http://192.168.1.10:8080" {
+		t.Errorf("unexpected URL %s", got.URL())
+	}
+
+	// Without address records, the sender's address is used.
+	parsed.extra = parsed.extra[:2]
+	if servers := serversIn(parsed, net.IPv4(10, 0, 0, 1)); servers[0].URL() != "http://10.0.0.1:8080" {
+		t.Errorf("expected the source address, got %s", servers[0].URL())
+	}
+
+	// Withdrawn services are skipped.
+	goodbye, _ := parseMessage(s.announcement(0).pack())
+	if servers := serversIn(goodbye, nil); len(servers) != 0 {
+		t.Errorf("expected withdrawn services to be skipped, got %+v", servers)
+	}
+}
+
+func TestAdvertiseBrowse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- Advertise(ctx, testService) }()
+
+	browseCtx, browseCancel := context.WithTimeout(ctx, time.Second)
+	defer browseCancel()
+	servers, err := Browse(browseCtx)
+
+	select {
+	case err := <-done:
+		t.Skipf("multicast is unavailable: %v", err)
+	default:
+	}
+	if err != nil {
+		t.Skipf("multicast is unavailable: %v", err)
+	}
+
+	i := slices.IndexFunc(servers, func(s Server) bool { return s.Instance == "office" })
+	if i < 0 {
+		t.Skipf("multicast loopback is unavailable, found %+v", servers)
+	}
+	if servers[i].URL() != "http://192.168.1.10:8080" {
+		t.Errorf("unexpected URL %s", servers[i].URL())
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Advertise failed: %v", err)
+	}
+}
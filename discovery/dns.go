@@ -0,0 +1,284 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+// DNS record types and classes used by mDNS service discovery.
+const (
+	typeA    = 1
+	typePTR  = 12
+	typeTXT  = 16
+	typeAAAA = 28
+	typeSRV  = 33
+	typeANY  = 255
+
+	classIN = 1
+
+	// classMask strips the mDNS cache-flush bit (in records) and
+	// unicast-response bit (in questions) from a class.
+	classMask = 0x7fff
+	// cacheFlush marks records that replace, rather than add to, what
+	// caches hold.
+	cacheFlush = 0x8000
+
+	flagResponse      = 0x8000
+	flagAuthoritative = 0x0400
+)
+
+var errMalformed = errors.New("malformed DNS message")
+
+type question struct {
+	name  string
+	qtype uint16
+	class uint16
+}
+
+// record is a resource record. Which of the data fields is set depends on
+// the type.
+type record struct {
+	name  string
+	rtype uint16
+	class uint16
+	ttl   uint32
+
+	target string   // PTR, SRV
+	port   uint16   // SRV
+	txt    []string // TXT
+	ip     net.IP   // A, AAAA
+}
+
+// message is a DNS message. Authority and additional records are merged
+// into extra.
+type message struct {
+	id        uint16
+	flags     uint16
+	questions []question
+	answers   []record
+	extra     []record
+}
+
+func (m *message) isResponse() bool {
+	return m.flags&flagResponse != 0
+}
+
+// pack encodes m. Names are not compressed.
+func (m *message) pack() []byte {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.id)
+	binary.BigEndian.PutUint16(b[2:], m.flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.answers)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.extra)))
+
+	for _, q := range m.questions {
+		b = appendName(b, q.name)
+		b = binary.BigEndian.AppendUint16(b, q.qtype)
+		b = binary.BigEndian.AppendUint16(b, q.class)
+	}
+	for _, r := range m.answers {
+		b = r.append(b)
+	}
+	for _, r := range m.extra {
+		b = r.append(b)
+	}
+	return b
+}
+
+func (r *record) append(b []byte) []byte {
+	b = appendName(b, r.name)
+	b = binary.BigEndian.AppendUint16(b, r.rtype)
+	b = binary.BigEndian.AppendUint16(b, r.class)
+	b = binary.BigEndian.AppendUint32(b, r.ttl)
+
+	var data []byte
+	switch r.rtype {
+	case typePTR:
+		data = appendName(nil, r.target)
+	case typeSRV:
+		data = make([]byte, 4) // Priority and weight.
+		data = binary.BigEndian.AppendUint16(data, r.port)
+		data = appendName(data, r.target)
+	case typeTXT:
+		for _, s := range r.txt {
+			data = append(data, byte(len(s)))
+			data = append(data, s...)
+		}
+		if len(data) == 0 {
+			data = []byte{0}
+		}
+	case typeA:
+		data = r.ip.To4()
+	case typeAAAA:
+		data = r.ip.To16()
+	}
+
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// appendName encodes a dotted name. Labels are truncated to 63 bytes.
+func appendName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		if len(label) > 63 {
+			label = label[:63]
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func parseMessage(b []byte) (*message, error) {
+	if len(b) < 12 {
+		return nil, errMalformed
+	}
+
+	m := &message{
+		id:    binary.BigEndian.Uint16(b[0:]),
+		flags: binary.BigEndian.Uint16(b[2:]),
+	}
+	qdcount := int(binary.BigEndian.Uint16(b[4:]))
+	ancount := int(binary.BigEndian.Uint16(b[6:]))
+	extracount := int(binary.BigEndian.Uint16(b[8:])) + int(binary.BigEndian.Uint16(b[10:]))
+
+	off := 12
+	for range qdcount {
+		name, n, err := readName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if off+4 > len(b) {
+			return nil, errMalformed
+		}
+		m.questions = append(m.questions, question{
+			name:  name,
+			qtype: binary.BigEndian.Uint16(b[off:]),
+			class: binary.BigEndian.Uint16(b[off+2:]),
+		})
+		off += 4
+	}
+
+	for i := range ancount + extracount {
+		r, n, err := readRecord(b, off)
+		if err != nil {
+			return nil, err
+		}
+		off = n
+		if i < ancount {
+			m.answers = append(m.answers, r)
+		} else {
+			m.extra = append(m.extra, r)
+		}
+	}
+
+	return m, nil
+}
+
+func readRecord(b []byte, off int) (record, int, error) {
+	var r record
+
+	name, off, err := readName(b, off)
+	if err != nil {
+		return r, 0, err
+	}
+	if off+10 > len(b) {
+		return r, 0, errMalformed
+	}
+	r.name = name
+	r.rtype = binary.BigEndian.Uint16(b[off:])
+	r.class = binary.BigEndian.Uint16(b[off+2:])
+	r.ttl = binary.BigEndian.Uint32(b[off+4:])
+	length := int(binary.BigEndian.Uint16(b[off+8:]))
+	off += 10
+
+	end := off + length
+	if end > len(b) {
+		return r, 0, errMalformed
+	}
+	data := b[off:end]
+
+	switch r.rtype {
+	case typePTR:
+		if r.target, _, err = readName(b, off); err != nil {
+			return r, 0, err
+		}
+	case typeSRV:
+		if length < 7 {
+			return r, 0, errMalformed
+		}
+		r.port = binary.BigEndian.Uint16(data[4:])
+		if r.target, _, err = readName(b, off+6); err != nil {
+			return r, 0, err
+		}
+	case typeTXT:
+		for len(data) > 0 {
+			n := int(data[0])
+			if 1+n > len(data) {
+				return r, 0, errMalformed
+			}
+			if n > 0 {
+				r.txt = append(r.txt, string(data[1:1+n]))
+			}
+			data = data[1+n:]
+		}
+	case typeA, typeAAAA:
+		if length == net.IPv4len || length == net.IPv6len {
+			r.ip = net.IP(append([]byte(nil), data...))
+		}
+	}
+
+	return r, end, nil
+}
+
+// readName decodes the possibly compressed name at off, returning it with a
+// trailing dot and the offset right after it.
+func readName(b []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+
+	// Every pointer must go backwards, which rules out loops.
+	for limit := off; ; {
+		if off >= len(b) {
+			return "", 0, errMalformed
+		}
+		n := int(b[off])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(b) {
+				return "", 0, errMalformed
+			}
+			ptr := int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+			if ptr >= limit {
+				return "", 0, errMalformed
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off, limit = ptr, ptr
+
+		case n&0xc0 != 0:
+			return "", 0, errMalformed
+
+		default:
+			if off+1+n > len(b) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(b[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
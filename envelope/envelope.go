@@ -0,0 +1,160 @@
+// Package envelope encrypts clipboard content with a passphrase, so that the
+// server only ever sees ciphertext.
+//
+// An envelope is a JSON object, which both the Go client and the web UI
+// (through WebCrypto) read and write:
+//
+//	{
+//	  "clipshare_envelope": 1,
+//	  "kdf": "PBKDF2-SHA256",
+//	  "iterations": 600000,
+//	  "salt": "<base64>",
+//	  "nonce": "<base64>",
+//	  "ciphertext": "<base64>"
+//	}
+//
+// The key is derived from the passphrase with PBKDF2-SHA256 and a random
+// 16-byte salt, and the content is encrypted with AES-256-GCM under a random
+// 12-byte nonce. The ciphertext ends with the GCM tag. Base64 is standard,
+// padded base64.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Version is the envelope format version.
+	Version = 1
+
+	// KDF names the key derivation function.
+	KDF = "PBKDF2-SHA256"
+
+	// Iterations is the PBKDF2 iteration count of new envelopes.
+	Iterations = 600_000
+
+	// maxIterations bounds the work that opening an envelope may take.
+	maxIterations = 10_000_000
+
+	saltSize = 16
+	keySize  = 32
+)
+
+var (
+	// ErrNotSealed is returned when opening something that isn't an
+	// envelope.
+	ErrNotSealed = errors.New("not an encrypted envelope")
+
+	// ErrWrongPassphrase is returned when an envelope can't be decrypted,
+	// either because the passphrase is wrong or because it was tampered
+	// with.
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted envelope")
+
+	errEmptyPassphrase = errors.New("empty passphrase")
+)
+
+type sealed struct {
+	Version    int    `json:"clipshare_envelope"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// IsSealed reports whether s looks like an envelope.
+func IsSealed(s string) bool {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.Contains(s, `"clipshare_envelope"`) {
+		return false
+	}
+	var e sealed
+	return json.Unmarshal([]byte(s), &e) == nil && e.Version > 0
+}
+
+// Seal encrypts plaintext with passphrase and returns the envelope.
+func Seal(plaintext []byte, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", errEmptyPassphrase
+	}
+
+	e := sealed{
+		Version:    Version,
+		KDF:        KDF,
+		Iterations: Iterations,
+		Salt:       make([]byte, saltSize),
+	}
+	rand.Read(e.Salt)
+
+	aead, err := newAEAD(passphrase, e.Salt, e.Iterations)
+	if err != nil {
+		return "", err
+	}
+	e.Nonce = make([]byte, aead.NonceSize())
+	rand.Read(e.Nonce)
+	e.Ciphertext = aead.Seal(nil, e.Nonce, plaintext, nil)
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Open decrypts the envelope s with passphrase.
+func Open(s, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errEmptyPassphrase
+	}
+	if !IsSealed(s) {
+		return nil, ErrNotSealed
+	}
+
+	var e sealed
+	if err := json.Unmarshal([]byte(strings.TrimSpace(s)), &e); err != nil {
+		return nil, ErrNotSealed
+	}
+	if e.Version != Version {
+		return nil, fmt.Errorf("unsupported envelope version %d", e.Version)
+	}
+	if e.KDF != KDF {
+		return nil, fmt.Errorf("unsupported key derivation %q", e.KDF)
+	}
+	if e.Iterations < 1 || e.Iterations > maxIterations {
+		return nil, fmt.Errorf("invalid iteration count %d", e.Iterations)
+	}
+
+	aead, err := newAEAD(passphrase, e.Salt, e.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(e.Nonce))
+	}
+
+	plaintext, err := aead.Open(nil, e.Nonce, e.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+func newAEAD(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
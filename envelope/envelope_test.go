@@ -0,0 +1,130 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestOpenBrowserFixtures opens envelopes sealed by the web UI, see
+// server/static/crypto.js.
+func TestOpenBrowserFixtures(t *testing.T) {
+	data, err := os.ReadFile("testdata/browser.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixtures []struct {
+		Passphrase string `json:"passphrase"`
+		Plaintext  []byte `json:"plaintext"`
+		Envelope   string `json:"envelope"`
+	}
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range fixtures {
+		if !IsSealed(f.Envelope) {
+			t.Errorf("%q: not recognized as an envelope", f.Passphrase)
+			continue
+		}
+		plaintext, err := Open(f.Envelope, f.Passphrase)
+		if err != nil {
+			t.Errorf("%q: %v", f.Passphrase, err)
+			continue
+		}
+		if !bytes.Equal(plaintext, f.Plaintext) {
+			t.Errorf("%q: expected %q, got %q", f.Passphrase, f.Plaintext, plaintext)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	plaintext := []byte("hello world")
+
+	a, err := Seal(plaintext, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Seal(plaintext, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("expected a fresh salt and nonce for every envelope")
+	}
+	if strings.Contains(a, "hello") {
+		t.Errorf("plaintext leaked into %s", a)
+	}
+
+	got, err := Open(a, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("expected %q, got %q", plaintext, got)
+	}
+
+	if _, err := Open(a, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+func TestOpenInvalid(t *testing.T) {
+	valid, err := Seal([]byte("x"), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e sealed
+	json.Unmarshal([]byte(valid), &e)
+
+	modified := func(f func(e *sealed)) string {
+		c := e
+		c.Ciphertext = bytes.Clone(e.Ciphertext)
+		f(&c)
+		data, _ := json.Marshal(c)
+		return string(data)
+	}
+
+	tests := []struct {
+		name     string
+		envelope string
+		want     error
+	}{
+		{"plain text", "hello", ErrNotSealed},
+		{"other JSON", `{"text":"hello"}`, ErrNotSealed},
+		{"tampered", modified(func(e *sealed) { e.Ciphertext[0] ^= 1 }), ErrWrongPassphrase},
+		{"other version", modified(func(e *sealed) { e.Version = 2 }), nil},
+		{"other KDF", modified(func(e *sealed) { e.KDF = "scrypt" }), nil},
+		{"too many iterations", modified(func(e *sealed) { e.Iterations = maxIterations + 1 }), nil},
+		{"short nonce", modified(func(e *sealed) { e.Nonce = e.Nonce[:8] }), nil},
+	}
+	for _, tt := range tests {
+		_, err := Open(tt.envelope, "secret")
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		} else if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	if _, err := Seal([]byte("x"), ""); err == nil {
+		t.Error("expected an error for an empty passphrase")
+	}
+	if _, err := Open(valid, ""); err == nil {
+		t.Error("expected an error for an empty passphrase")
+	}
+}
+
+func TestIsSealed(t *testing.T) {
+	for _, s := range []string{"", "hello", "{}", `{"clipshare_envelope":0}`, `{"clipshare_envelope": "1"`} {
+		if IsSealed(s) {
+			t.Errorf("%q: unexpectedly sealed", s)
+		}
+	}
+	if !IsSealed(" \n" + `{"clipshare_envelope":1}` + "\n") {
+		t.Error("expected surrounding whitespace to be ignored")
+	}
+}
@@ -1,3 +1,3 @@
-module clipshare
+module github.com/aldur/clipshare
 
 go 1.24
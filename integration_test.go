@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -24,9 +25,16 @@ func startTestServer(t *testing.T) (context.CancelFunc, error) {
 	os.Setenv("HOST", testHost)
 	os.Setenv("PORT", testPort)
 	
+	// Build the server first: killing `go run` would leave the server
+	// binary running.
+	bin := filepath.Join(t.TempDir(), "clipshare-server")
+	if output, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to build server: %w: %s", err, output)
+	}
+
 	// Start server in background
 	ctx, cancel := context.WithCancel(context.Background())
-	cmd := exec.CommandContext(ctx, "go", "run", "main.go")
+	cmd := exec.CommandContext(ctx, bin)
 	cmd.Env = append(os.Environ(), "HOST="+testHost, "PORT="+testPort)
 	
 	if err := cmd.Start(); err != nil {
@@ -50,13 +58,16 @@ func startTestServer(t *testing.T) (context.CancelFunc, error) {
 		}
 	}
 	
-	return cancel, nil
+	return func() {
+		cancel()
+		cmd.Wait()
+	}, nil
 }
 
 func runClient(t *testing.T, args ...string) (string, error) {
 	t.Helper()
 	
-	cmd := exec.Command("go", append([]string{"run", "cmd/client/main.go"}, args...)...)
+	cmd := exec.Command("go", append([]string{"run", "./cmd/client"}, args...)...)
 	cmd.Env = append(os.Environ(), "CLIPSHARE_URL="+testURL)
 	
 	output, err := cmd.CombinedOutput()
@@ -118,7 +129,7 @@ func TestClientServerIntegration(t *testing.T) {
 		testText := "Stdin test content"
 		
 		// Set clipboard content from stdin (auto-detected)
-		cmd := exec.Command("go", "run", "cmd/client/main.go", "set")
+		cmd := exec.Command("go", "run", "./cmd/client", "set")
 		cmd.Env = append(os.Environ(), "CLIPSHARE_URL="+testURL)
 		cmd.Stdin = strings.NewReader(testText)
 		
@@ -143,7 +154,7 @@ func TestClientServerIntegration(t *testing.T) {
 		testText := "Explicit stdin test content"
 		
 		// Set clipboard content from stdin (explicit)
-		cmd := exec.Command("go", "run", "cmd/client/main.go", "set", "-")
+		cmd := exec.Command("go", "run", "./cmd/client", "set", "-")
 		cmd.Env = append(os.Environ(), "CLIPSHARE_URL="+testURL)
 		cmd.Stdin = strings.NewReader(testText)
 		
@@ -208,6 +219,43 @@ func TestClientServerIntegration(t *testing.T) {
 			}
 		}
 	})
+
+	// Test 7: Upload a file and save it elsewhere
+	t.Run("SetFileGetOutput", func(t *testing.T) {
+		dir := t.TempDir()
+		input := filepath.Join(dir, "notes.md")
+		if err := os.WriteFile(input, []byte("# Notes\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := runClient(t, "set", "-f", input); err != nil {
+			t.Fatalf("Failed to upload file: %v", err)
+		}
+
+		outDir := filepath.Join(dir, "out")
+		if err := os.Mkdir(outDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if output, err := runClient(t, "get", "-o", outDir); err != nil {
+			t.Fatalf("Failed to save file: %v: %s", err, output)
+		}
+
+		data, err := os.ReadFile(filepath.Join(outDir, "notes.md"))
+		if err != nil {
+			t.Fatalf("Expected file to be saved with its original name: %v", err)
+		}
+		if string(data) != "# Notes\n" {
+			t.Errorf("Expected %q, got %q", "# Notes\n", data)
+		}
+
+		// Refuse to overwrite without -force
+		if _, err := runClient(t, "get", "-o", outDir); err == nil {
+			t.Error("Expected an error when overwriting without -force")
+		}
+		if _, err := runClient(t, "get", "-o", outDir, "-force"); err != nil {
+			t.Errorf("Failed to overwrite with -force: %v", err)
+		}
+	})
 }
 
 func TestClientServerErrorHandling(t *testing.T) {
@@ -246,7 +294,7 @@ func TestClientEnvironmentVariables(t *testing.T) {
 		testText := "Environment device test"
 		
 		// Set clipboard with custom device via env var
-		cmd := exec.Command("go", "run", "cmd/client/main.go", "set", testText)
+		cmd := exec.Command("go", "run", "./cmd/client", "set", testText)
 		cmd.Env = append(os.Environ(), 
 			"CLIPSHARE_URL="+testURL,
 			"CLIPSHARE_DEVICE=env-device")
@@ -271,7 +319,7 @@ func TestClientEnvironmentVariables(t *testing.T) {
 func TestClientServerConnectionError(t *testing.T) {
 	// Test connection to non-existent server
 	t.Run("ConnectionError", func(t *testing.T) {
-		cmd := exec.Command("go", "run", "cmd/client/main.go", "get")
+		cmd := exec.Command("go", "run", "./cmd/client", "get")
 		cmd.Env = append(os.Environ(), "CLIPSHARE_URL=http://localhost:19999")
 
 		_, err := cmd.CombinedOutput()
@@ -279,6 +327,29 @@ func TestClientServerConnectionError(t *testing.T) {
 			t.Error("Expected error when connecting to non-existent server")
 		}
 	})
+
+	// Test sets are queued when a spool directory is configured
+	t.Run("SetQueuedInSpool", func(t *testing.T) {
+		spoolDir := t.TempDir()
+
+		cmd := exec.Command("go", "run", "./cmd/client", "-retries", "0", "set", "queued")
+		cmd.Env = append(os.Environ(),
+			"CLIPSHARE_URL=http://localhost:19999",
+			"CLIPSHARE_SPOOL="+spoolDir)
+
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Expected set to be queued, got %v: %s", err, output)
+		}
+
+		entries, err := os.ReadDir(spoolDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("Expected one queued set, got %d", len(entries))
+		}
+	})
 }
 
 func TestWebInterfaceTemplateRendering(t *testing.T) {
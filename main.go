@@ -1,99 +1,76 @@
 package main
 
 import (
-	_ "embed"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
-	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
-)
-
-type SetRequest struct {
-	Text   string `json:"text"`
-	Device string `json:"device"`
-}
-
-//go:embed index.html
-var indexHTML []byte
 
-var (
-	clipboard       string
-	mu              sync.RWMutex
-	clearTimer      *time.Timer
-	timerGeneration int64
+	"github.com/aldur/clipshare/discovery"
+	"github.com/aldur/clipshare/server"
 )
 
-func clipboardHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		mu.RLock()
-		defer mu.RUnlock()
-
-		w.Header().Set("Content-Type", "text/plain")
-		w.Write([]byte(clipboard))
-
-	case http.MethodPost:
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "Error reading request body", http.StatusBadRequest)
-			return
+// listEnv splits the comma-separated list in the environment variable name.
+func listEnv(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
+	}
+	return items
+}
 
-		var req SetRequest
-		if err := json.Unmarshal(body, &req); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
-			return
+// parsePrefixes parses a list of addresses and CIDR prefixes. Addresses
+// become single-address prefixes.
+func parsePrefixes(items []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range items {
+		if strings.Contains(item, "/") {
+			prefix, err := netip.ParsePrefix(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
 		}
-
-		mu.Lock()
-		defer mu.Unlock()
-		clipboard = req.Text
-
-		if clearTimer != nil {
-			clearTimer.Stop()
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, err
 		}
-
-		timerGeneration++
-		currentGen := timerGeneration
-		clearTimer = time.AfterFunc(60*time.Second, func() {
-			mu.Lock()
-			defer mu.Unlock()
-			if timerGeneration == currentGen {
-				clipboard = ""
-			}
-		})
-
-		w.WriteHeader(http.StatusOK)
-
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
 	}
+	return prefixes, nil
 }
 
-func indexHandler(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-		return
-	}
-
-	tmpl, err := template.New("index").Parse(string(indexHTML))
+// readWebhooks reads the webhook targets listed in the JSON file at path.
+func readWebhooks(path string) ([]server.Webhook, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		http.Error(w, "Error parsing template", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-
-	mu.RLock()
-	content := clipboard
-	mu.RUnlock()
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := tmpl.Execute(w, content); err != nil {
-		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+	var webhooks []server.Webhook
+	if err := json.Unmarshal(data, &webhooks); err != nil {
+		return nil, err
+	}
+	for _, w := range webhooks {
+		switch w.Content {
+		case "", server.ContentNone, server.ContentText, server.ContentAll:
+		default:
+			return nil, fmt.Errorf("invalid content policy %q for %s", w.Content, w.URL)
+		}
 	}
+	return webhooks, nil
 }
 
 func main() {
@@ -109,11 +86,113 @@ func main() {
 
 	addr := host + ":" + port
 
-	http.HandleFunc("/", indexHandler)
-	http.HandleFunc("/clipboard", clipboardHandler)
+	peerToken := os.Getenv("PEER_TOKEN")
+	if path := os.Getenv("PEER_TOKEN_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("clipshare-server failed to read peer token: %v\n", err)
+			os.Exit(1)
+		}
+		peerToken = strings.TrimSpace(string(data))
+	}
+
+	var sensitiveTTL time.Duration
+	if value := os.Getenv("SENSITIVE_TTL"); value != "" {
+		var err error
+		if sensitiveTTL, err = time.ParseDuration(value); err != nil {
+			fmt.Printf("clipshare-server failed to parse SENSITIVE_TTL: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var maxPinDuration time.Duration
+	if value := os.Getenv("MAX_PIN_DURATION"); value != "" {
+		var err error
+		if maxPinDuration, err = time.ParseDuration(value); err != nil {
+			fmt.Printf("clipshare-server failed to parse MAX_PIN_DURATION: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	trustedProxies, err := parsePrefixes(listEnv("TRUSTED_PROXIES"))
+	if err != nil {
+		fmt.Printf("clipshare-server failed to parse TRUSTED_PROXIES: %v\n", err)
+		os.Exit(1)
+	}
+
+	var webhooks []server.Webhook
+	if path := os.Getenv("WEBHOOKS_FILE"); path != "" {
+		if webhooks, err = readWebhooks(path); err != nil {
+			fmt.Printf("clipshare-server failed to read webhooks: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	snippets, err := server.OpenSnippets(os.Getenv("SNIPPETS_FILE"))
+	if err != nil {
+		fmt.Printf("clipshare-server failed to read snippets: %v\n", err)
+		os.Exit(1)
+	}
+
+	srv := server.New(server.Options{
+		SensitiveTTL:   sensitiveTTL,
+		MaxPinDuration: maxPinDuration,
+		Origin:         os.Getenv("ORIGIN"),
+		Peers:          listEnv("PEERS"),
+		PeerToken:      peerToken,
+		AllowedOrigins: listEnv("CORS_ORIGINS"),
+		TrustedProxies: trustedProxies,
+		Webhooks:       webhooks,
+		Snippets:       snippets,
+	})
+	defer srv.Close()
+
+	// The server stops on SIGINT and SIGTERM, after withdrawing its mDNS
+	// announcement.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var advertising sync.WaitGroup
+	if advertise, _ := strconv.ParseBool(os.Getenv("ADVERTISE")); advertise {
+		portNumber, err := strconv.Atoi(port)
+		if err != nil {
+			fmt.Printf("clipshare-server failed to advertise: invalid port %q\n", port)
+			os.Exit(1)
+		}
+
+		svc := discovery.Service{Instance: os.Getenv("ORIGIN"), Port: portNumber, TXT: []string{"path=/"}}
+		ip := net.ParseIP(host)
+		if ip != nil && !ip.IsUnspecified() {
+			svc.IPs = []net.IP{ip}
+		}
+		if host == "localhost" || ip.IsLoopback() {
+			fmt.Printf("clipshare-server is advertised but only listens on %s, set HOST to accept other devices\n", host)
+		}
+
+		advertising.Add(1)
+		go func() {
+			defer advertising.Done()
+			if err := discovery.Advertise(ctx, svc); err != nil {
+				fmt.Printf("clipshare-server failed to advertise: %v\n", err)
+			}
+		}()
+	}
+
+	httpServer := &http.Server{Addr: addr, Handler: srv}
+	go func() {
+		<-ctx.Done()
+		// Event streams never go idle, so they are cut after a grace period.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			httpServer.Close()
+		}
+	}()
 
 	fmt.Printf("clipshare-server starting on http://%s\n", addr)
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		fmt.Printf("clipshare-server failed to start: %v\n", err)
 	}
+	stop()
+	advertising.Wait()
 }
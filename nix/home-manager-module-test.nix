@@ -37,6 +37,18 @@ let
               type = lib.types.attrsOf lib.types.str;
               default = { };
             };
+            xdg.configFile = lib.mkOption {
+              type = lib.types.attrsOf (
+                lib.types.submodule {
+                  options.text = lib.mkOption { type = lib.types.lines; };
+                }
+              );
+              default = { };
+            };
+            assertions = lib.mkOption {
+              type = lib.types.listOf lib.types.unspecified;
+              default = [ ];
+            };
             networking.hostName = lib.mkOption {
               type = lib.types.nullOr lib.types.str;
               default = "test-hostname";
@@ -406,6 +418,166 @@ let
         echo "PASS: No env vars when both url and device are null"
         touch $out
       '';
+
+    # Test 16: No config file without profiles
+    test-no-config-without-profiles =
+      let
+        result = evalModule {
+          programs.clipshare.enable = true;
+        };
+      in
+      pkgs.runCommand "test-no-config-without-profiles" { } ''
+        ${lib.optionalString (result.config.xdg.configFile ? "clipshare/config") ''
+          echo "FAIL: Config file should not be generated without profiles"
+          exit 1
+        ''}
+        echo "PASS: No config file without profiles"
+        touch $out
+      '';
+
+    # Test 17: Profiles generate the config file
+    test-profiles-config-file =
+      let
+        result = evalModule {
+          programs.clipshare = {
+            enable = true;
+            defaultProfile = "home";
+            profiles = {
+              home.url = "http://100.64.0.1:8080";
+              work = {
+                url = "https://clipshare.example.com";
+                tokenFile = "/run/secrets/clipshare-token";
+                passphraseFile = "/run/secrets/clipshare-passphrase";
+                channel = "team";
+                insecureSkipVerify = true;
+              };
+            };
+          };
+        };
+        configFile = pkgs.writeText "clipshare-config" result.config.xdg.configFile."clipshare/config".text;
+      in
+      pkgs.runCommand "test-profiles-config-file" { } ''
+        for line in \
+          "default_profile = home" \
+          "[home]" \
+          "url = http://100.64.0.1:8080" \
+          "[work]" \
+          "url = https://clipshare.example.com" \
+          "token_file = /run/secrets/clipshare-token" \
+          "passphrase_file = /run/secrets/clipshare-passphrase" \
+          "channel = team" \
+          "insecure_skip_verify = true"; do
+          if ! grep -qxF "$line" ${configFile}; then
+            echo "FAIL: Config file should contain '$line'"
+            cat ${configFile}
+            exit 1
+          fi
+        done
+        if grep -q "ca_file" ${configFile}; then
+          echo "FAIL: Unset options should not be written"
+          exit 1
+        fi
+        echo "PASS: Profiles generate the config file"
+        touch $out
+      '';
+
+    # Test 18: Unknown default profile fails the assertion
+    test-default-profile-assertion =
+      let
+        result = evalModule {
+          programs.clipshare = {
+            enable = true;
+            defaultProfile = "missing";
+            profiles.home.url = "http://100.64.0.1:8080";
+          };
+        };
+        failed = builtins.any (a: !a.assertion) result.config.assertions;
+      in
+      pkgs.runCommand "test-default-profile-assertion" { } ''
+        ${lib.optionalString (!failed) ''
+          echo "FAIL: An unknown defaultProfile should fail an assertion"
+          exit 1
+        ''}
+        echo "PASS: Unknown default profile is rejected"
+        touch $out
+      '';
+
+    # Test 19: Completions are installed by default
+    test-completions-enabled-by-default =
+      let
+        result = evalModule {
+          programs.clipshare.enable = true;
+        };
+        names = map (p: p.name) result.config.home.packages;
+      in
+      pkgs.runCommand "test-completions-enabled-by-default" { } ''
+        ${lib.optionalString (!builtins.elem "clipshare-completions" names) ''
+          echo "FAIL: Completions should be installed by default"
+          exit 1
+        ''}
+        echo "PASS: Completions installed by default"
+        touch $out
+      '';
+
+    # Test 20: Completions can be disabled
+    test-completions-disabled =
+      let
+        result = evalModule {
+          programs.clipshare = {
+            enable = true;
+            enableCompletions = false;
+          };
+        };
+        names = map (p: p.name) result.config.home.packages;
+      in
+      pkgs.runCommand "test-completions-disabled" { } ''
+        ${lib.optionalString (builtins.elem "clipshare-completions" names) ''
+          echo "FAIL: Completions should not be installed when disabled"
+          exit 1
+        ''}
+        echo "PASS: Completions can be disabled"
+        touch $out
+      '';
+
+    # Test 21: With profiles, url and device go to the config file, not the
+    # environment, which would override every profile
+    test-profiles-no-env-vars =
+      let
+        result = evalModule {
+          programs.clipshare = {
+            enable = true;
+            url = "http://myserver:8080";
+            device = "my-laptop";
+            profiles = {
+              work.url = "https://clipshare.example.com";
+              phone = {
+                url = "http://100.64.0.2:8080";
+                device = "my-phone";
+              };
+            };
+          };
+        };
+        vars = result.config.home.sessionVariables;
+        configFile = pkgs.writeText "clipshare-config" result.config.xdg.configFile."clipshare/config".text;
+      in
+      pkgs.runCommand "test-profiles-no-env-vars" { } ''
+        ${lib.optionalString (vars ? CLIPSHARE_URL || vars ? CLIPSHARE_DEVICE) ''
+          echo "FAIL: CLIPSHARE_URL and CLIPSHARE_DEVICE should not be set with profiles"
+          exit 1
+        ''}
+        for section in \
+          "[default]|device = my-laptop|url = http://myserver:8080" \
+          "[work]|device = my-laptop|url = https://clipshare.example.com" \
+          "[phone]|device = my-phone|url = http://100.64.0.2:8080"; do
+          if ! tr '\n' '|' < ${configFile} | grep -qF "$section|"; then
+            echo "FAIL: Config file should contain '$section'"
+            cat ${configFile}
+            exit 1
+          fi
+        done
+        echo "PASS: Profiles take the top-level url and device"
+        touch $out
+      '';
   };
 
   # Combine all tests - use runCommand to aggregate results
@@ -11,17 +11,155 @@ with lib;
 let
   cfg = config.programs.clipshare;
 
-  # Build environment variable exports only for configured options
-  envExports = concatStringsSep "\n" (
-    optional (cfg.url != null) ''export CLIPSHARE_URL="${cfg.url}"''
-    ++ optional (cfg.device != null) ''export CLIPSHARE_DEVICE="${cfg.device}"''
-  );
+  # The environment takes precedence over every profile, so the top-level url
+  # and device are only exported without profiles. Otherwise they are written
+  # to the config file: the url to the default profile, and the device to the
+  # profiles that don't set their own.
+  useEnv = cfg.profiles == { };
+
+  envVars =
+    optionalAttrs (useEnv && cfg.url != null) { CLIPSHARE_URL = cfg.url; }
+    // optionalAttrs (useEnv && cfg.device != null) { CLIPSHARE_DEVICE = cfg.device; };
+
+  envExports = concatStringsSep "\n" (mapAttrsToList (k: v: ''export ${k}="${v}"'') envVars);
+
+  emptyProfile = mapAttrs (_: opt: opt.default) profileOptions.options;
+
+  profiles = mapAttrs (
+    name: profile:
+    profile
+    // {
+      url = if profile.url == null && name == "default" then cfg.url else profile.url;
+      device = if profile.device == null then cfg.device else profile.device;
+    }
+  ) (optionalAttrs (cfg.url != null) { default = emptyProfile; } // cfg.profiles);
 
   clientWrapper = pkgs.writeShellScriptBin "clipshare" ''
     ${envExports}
     exec ${cfg.package}/bin/clipshare "$@"
   '';
 
+  # Completion scripts, installed where bash-completion, zsh and fish look for
+  # them in the home-manager profile
+  completions = pkgs.runCommand "clipshare-completions" { } ''
+    mkdir -p $out/share/bash-completion/completions $out/share/zsh/site-functions $out/share/fish/vendor_completions.d
+    ${cfg.package}/bin/clipshare completion bash > $out/share/bash-completion/completions/clipshare
+    ${cfg.package}/bin/clipshare completion zsh > $out/share/zsh/site-functions/_clipshare
+    ${cfg.package}/bin/clipshare completion fish > $out/share/fish/vendor_completions.d/clipshare.fish
+  '';
+
+  # Render a profile as an INI section, skipping unset values
+  renderProfile =
+    name: profile:
+    let
+      settings = filterAttrs (_: v: v != null) {
+        inherit (profile) url device channel;
+        token = profile.token;
+        token_file = profile.tokenFile;
+        ca_file = profile.caFile;
+        cert_file = profile.certFile;
+        key_file = profile.keyFile;
+        insecure_skip_verify = if profile.insecureSkipVerify then "true" else null;
+        timeout = profile.timeout;
+        retries = if profile.retries != null then toString profile.retries else null;
+        spool_dir = profile.spoolDir;
+        passphrase_file = profile.passphraseFile;
+      };
+    in
+    ''
+      [${name}]
+      ${concatStringsSep "\n" (mapAttrsToList (k: v: "${k} = ${v}") settings)}
+    '';
+
+  configFile = concatStringsSep "\n" (
+    optional (cfg.defaultProfile != null) "default_profile = ${cfg.defaultProfile}\n"
+    ++ mapAttrsToList renderProfile profiles
+  );
+
+  profileOptions = {
+    options = {
+      url = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        description = "URL of the clipshare server.";
+      };
+
+      device = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        description = "Device name to use when setting clipboard content.";
+      };
+
+      channel = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        description = "Default clipboard channel.";
+      };
+
+      token = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        description = "Bearer token sent to the server. It will be world-readable in the Nix store; prefer `tokenFile`.";
+      };
+
+      tokenFile = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        description = "Path to a file containing the bearer token sent to the server.";
+      };
+
+      caFile = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        description = "PEM file with the CA certificates used to verify the server.";
+      };
+
+      certFile = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        description = "PEM client certificate for mutual TLS.";
+      };
+
+      keyFile = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        description = "PEM client key for mutual TLS.";
+      };
+
+      insecureSkipVerify = mkOption {
+        type = types.bool;
+        default = false;
+        description = "Whether to skip verification of the server certificate.";
+      };
+
+      timeout = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        example = "30s";
+        description = "Request timeout, as a Go duration.";
+      };
+
+      retries = mkOption {
+        type = types.nullOr types.ints.unsigned;
+        default = null;
+        description = "How many times `get` and `clear` are retried on network errors.";
+      };
+
+      spoolDir = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        example = "~/.local/state/clipshare/spool";
+        description = "Directory where sets that failed on network errors are queued until the next invocation or `clipshare flush`.";
+      };
+
+      passphraseFile = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        description = "Path to a file containing the passphrase that encrypts clipboard content end to end.";
+      };
+    };
+  };
+
   aliases = {
     cs = "clipshare";
     cs-get = "clipshare get";
@@ -42,14 +180,36 @@ in
     url = mkOption {
       type = types.nullOr types.str;
       default = null;
-      description = "URL of the clipshare server. If not set, no CLIPSHARE_URL environment variable will be exported.";
+      description = "URL of the clipshare server. It is exported as CLIPSHARE_URL, or written to the `default` profile when `profiles` are set, since the environment would override every profile.";
     };
 
     device = mkOption {
       type = types.nullOr types.str;
       default = config.networking.hostName or null;
       defaultText = literalExpression "config.networking.hostName or null";
-      description = "Device name to use when setting clipboard content. Defaults to the hostname. If null, no CLIPSHARE_DEVICE environment variable will be exported.";
+      description = "Device name to use when setting clipboard content. Defaults to the hostname. It is exported as CLIPSHARE_DEVICE, or used by the `profiles` that don't set their own device when they are set.";
+    };
+
+    profiles = mkOption {
+      type = types.attrsOf (types.submodule profileOptions);
+      default = { };
+      example = literalExpression ''
+        {
+          home.url = "http://100.64.0.1:8080";
+          work = {
+            url = "https://clipshare.example.com";
+            tokenFile = "/run/secrets/clipshare-token";
+            channel = "team";
+          };
+        }
+      '';
+      description = "Named server profiles written to `$XDG_CONFIG_HOME/clipshare/config` and selected with `-profile`.";
+    };
+
+    defaultProfile = mkOption {
+      type = types.nullOr types.str;
+      default = null;
+      description = "Profile used when `-profile` is not given.";
     };
 
     enableAliases = mkOption {
@@ -57,15 +217,30 @@ in
       default = true;
       description = "Whether to enable shell aliases and functions.";
     };
+
+    enableCompletions = mkOption {
+      type = types.bool;
+      default = true;
+      description = "Whether to install bash, zsh and fish completions.";
+    };
   };
 
   config = mkIf cfg.enable {
+    assertions = [
+      {
+        assertion = cfg.defaultProfile == null || hasAttr cfg.defaultProfile cfg.profiles;
+        message = "programs.clipshare.defaultProfile must name one of programs.clipshare.profiles.";
+      }
+    ];
+
+    xdg.configFile."clipshare/config" = mkIf (cfg.profiles != { }) {
+      text = configFile;
+    };
+
     home = {
-      packages = [ clientWrapper ];
+      packages = [ clientWrapper ] ++ optional cfg.enableCompletions completions;
 
-      sessionVariables =
-        optionalAttrs (cfg.url != null) { CLIPSHARE_URL = cfg.url; }
-        // optionalAttrs (cfg.device != null) { CLIPSHARE_DEVICE = cfg.device; };
+      sessionVariables = envVars;
 
       shellAliases = mkIf cfg.enableAliases aliases;
     };
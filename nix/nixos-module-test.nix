@@ -49,6 +49,10 @@ let
               type = lib.types.listOf lib.types.port;
               default = [ ];
             };
+            networking.firewall.allowedUDPPorts = lib.mkOption {
+              type = lib.types.listOf lib.types.port;
+              default = [ ];
+            };
           };
         }
 
@@ -328,6 +332,248 @@ let
         echo "PASS: Service ordering correct"
         touch $out
       '';
+
+    # Test 13: Replication is off by default
+    test-replication-disabled-by-default =
+      let
+        result = evalModule {
+          services.clipshare.enable = true;
+        };
+        svc = result.config.systemd.services.clipshare;
+      in
+      pkgs.runCommand "test-replication-disabled-by-default" { } ''
+        ${lib.optionalString (svc.environment ? PEERS || svc.environment ? PEER_TOKEN_FILE) ''
+          echo "FAIL: Replication should not be configured by default"
+          exit 1
+        ''}
+        ${lib.optionalString (svc.serviceConfig ? LoadCredential) ''
+          echo "FAIL: No credentials should be loaded by default"
+          exit 1
+        ''}
+        echo "PASS: Replication disabled by default"
+        touch $out
+      '';
+
+    # Test 14: Peers and token file
+    test-replication-peers =
+      let
+        result = evalModule {
+          services.clipshare = {
+            enable = true;
+            origin = "site-a";
+            peers = [
+              "https://b.example.com"
+              "https://c.example.com"
+            ];
+            peerTokenFile = "/run/secrets/clipshare-peer-token";
+          };
+        };
+        svc = result.config.systemd.services.clipshare;
+      in
+      pkgs.runCommand "test-replication-peers" { } ''
+        if [ "${svc.environment.PEERS}" != "https://b.example.com,https://c.example.com" ]; then
+          echo "FAIL: PEERS should list the peers"
+          exit 1
+        fi
+        if [ "${svc.environment.ORIGIN}" != "site-a" ]; then
+          echo "FAIL: ORIGIN should be set"
+          exit 1
+        fi
+        if [ "${toString svc.serviceConfig.LoadCredential}" != "peer-token:/run/secrets/clipshare-peer-token" ]; then
+          echo "FAIL: The peer token should be loaded as a credential"
+          exit 1
+        fi
+        if [ "${svc.environment.PEER_TOKEN_FILE}" != "%d/peer-token" ]; then
+          echo "FAIL: PEER_TOKEN_FILE should point to the credential"
+          exit 1
+        fi
+        echo "PASS: Replication configured"
+        touch $out
+      '';
+
+    # Test 15: mDNS advertisement opens its port
+    test-advertise =
+      let
+        result = evalModule {
+          services.clipshare = {
+            enable = true;
+            advertise = true;
+            openFirewall = true;
+          };
+        };
+        svc = result.config.systemd.services.clipshare;
+      in
+      pkgs.runCommand "test-advertise" { } ''
+        if [ "${svc.environment.ADVERTISE}" != "true" ]; then
+          echo "FAIL: ADVERTISE should be set"
+          exit 1
+        fi
+        ${lib.optionalString (!builtins.elem 5353 result.config.networking.firewall.allowedUDPPorts) ''
+          echo "FAIL: Firewall should allow mDNS"
+          exit 1
+        ''}
+        echo "PASS: mDNS advertisement configured"
+        touch $out
+      '';
+
+    # Test 16: CORS origins
+    test-cors-origins =
+      let
+        disabled = (evalModule { services.clipshare.enable = true; }).config.systemd.services.clipshare;
+        result = evalModule {
+          services.clipshare = {
+            enable = true;
+            corsOrigins = [
+              "https://example.com"
+              "chrome-extension://abcdef"
+            ];
+          };
+        };
+        svc = result.config.systemd.services.clipshare;
+      in
+      pkgs.runCommand "test-cors-origins" { } ''
+        ${lib.optionalString (disabled.environment ? CORS_ORIGINS) ''
+          echo "FAIL: CORS should be disabled by default"
+          exit 1
+        ''}
+        if [ "${svc.environment.CORS_ORIGINS}" != "https://example.com,chrome-extension://abcdef" ]; then
+          echo "FAIL: CORS_ORIGINS should list the origins"
+          exit 1
+        fi
+        echo "PASS: CORS origins configured"
+        touch $out
+      '';
+
+    # Test 17: Sensitive content TTL
+    test-sensitive-ttl =
+      let
+        disabled = (evalModule { services.clipshare.enable = true; }).config.systemd.services.clipshare;
+        result = evalModule {
+          services.clipshare = {
+            enable = true;
+            sensitiveTTL = "10s";
+          };
+        };
+        svc = result.config.systemd.services.clipshare;
+      in
+      pkgs.runCommand "test-sensitive-ttl" { } ''
+        ${lib.optionalString (disabled.environment ? SENSITIVE_TTL) ''
+          echo "FAIL: SENSITIVE_TTL should not be set by default"
+          exit 1
+        ''}
+        if [ "${svc.environment.SENSITIVE_TTL}" != "10s" ]; then
+          echo "FAIL: SENSITIVE_TTL should be set"
+          exit 1
+        fi
+        echo "PASS: Sensitive content TTL configured"
+        touch $out
+      '';
+
+    # Test 18: Trusted proxies
+    test-trusted-proxies =
+      let
+        disabled = (evalModule { services.clipshare.enable = true; }).config.systemd.services.clipshare;
+        result = evalModule {
+          services.clipshare = {
+            enable = true;
+            trustedProxies = [
+              "127.0.0.1"
+              "::1"
+            ];
+          };
+        };
+        svc = result.config.systemd.services.clipshare;
+      in
+      pkgs.runCommand "test-trusted-proxies" { } ''
+        ${lib.optionalString (disabled.environment ? TRUSTED_PROXIES) ''
+          echo "FAIL: No proxy should be trusted by default"
+          exit 1
+        ''}
+        if [ "${svc.environment.TRUSTED_PROXIES}" != "127.0.0.1,::1" ]; then
+          echo "FAIL: TRUSTED_PROXIES should list the proxies"
+          exit 1
+        fi
+        echo "PASS: Trusted proxies configured"
+        touch $out
+      '';
+
+    # Test 19: Webhooks file
+    test-webhooks =
+      let
+        result = evalModule {
+          services.clipshare = {
+            enable = true;
+            peerTokenFile = "/run/secrets/clipshare-peer-token";
+            webhooksFile = "/run/secrets/clipshare-webhooks.json";
+          };
+        };
+        svc = result.config.systemd.services.clipshare;
+      in
+      pkgs.runCommand "test-webhooks" { } ''
+        if [ "${toString svc.serviceConfig.LoadCredential}" != "peer-token:/run/secrets/clipshare-peer-token webhooks:/run/secrets/clipshare-webhooks.json" ]; then
+          echo "FAIL: The webhooks file should be loaded as a credential"
+          exit 1
+        fi
+        if [ "${svc.environment.WEBHOOKS_FILE}" != "%d/webhooks" ]; then
+          echo "FAIL: WEBHOOKS_FILE should point to the credential"
+          exit 1
+        fi
+        echo "PASS: Webhooks configured"
+        touch $out
+      '';
+
+    # Test 20: Maximum pin duration
+    test-max-pin-duration =
+      let
+        disabled = (evalModule { services.clipshare.enable = true; }).config.systemd.services.clipshare;
+        result = evalModule {
+          services.clipshare = {
+            enable = true;
+            maxPinDuration = "24h";
+          };
+        };
+        svc = result.config.systemd.services.clipshare;
+      in
+      pkgs.runCommand "test-max-pin-duration" { } ''
+        ${lib.optionalString (disabled.environment ? MAX_PIN_DURATION) ''
+          echo "FAIL: MAX_PIN_DURATION should not be set by default"
+          exit 1
+        ''}
+        if [ "${svc.environment.MAX_PIN_DURATION}" != "24h" ]; then
+          echo "FAIL: MAX_PIN_DURATION should be set"
+          exit 1
+        fi
+        echo "PASS: Maximum pin duration configured"
+        touch $out
+      '';
+
+    # Test 21: Snippets persistence
+    test-snippets =
+      let
+        svc = (evalModule { services.clipshare.enable = true; }).config.systemd.services.clipshare;
+        disabled = (evalModule {
+          services.clipshare = {
+            enable = true;
+            persistSnippets = false;
+          };
+        }).config.systemd.services.clipshare;
+      in
+      pkgs.runCommand "test-snippets" { } ''
+        if [ "${svc.serviceConfig.StateDirectory}" != "clipshare" ]; then
+          echo "FAIL: The state directory should be created by default"
+          exit 1
+        fi
+        if [ "${svc.environment.SNIPPETS_FILE}" != "%S/clipshare/snippets.json" ]; then
+          echo "FAIL: SNIPPETS_FILE should be in the state directory"
+          exit 1
+        fi
+        ${lib.optionalString (disabled.environment ? SNIPPETS_FILE) ''
+          echo "FAIL: SNIPPETS_FILE should not be set when persistence is disabled"
+          exit 1
+        ''}
+        echo "PASS: Snippets persisted"
+        touch $out
+      '';
   };
 
   # Combine all tests - use runCommand to aggregate results
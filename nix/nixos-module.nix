@@ -45,6 +45,71 @@ in
       default = false;
       description = "Whether to open the firewall for the clipshare server.";
     };
+
+    advertise = mkOption {
+      type = types.bool;
+      default = false;
+      description = "Whether to advertise the server on the local network with mDNS, for `clipshare discover`. Set `host` to an address other devices can reach.";
+    };
+
+    origin = mkOption {
+      type = types.nullOr types.str;
+      default = null;
+      description = "Name of this server among its peers. Defaults to the host name.";
+    };
+
+    peers = mkOption {
+      type = types.listOf types.str;
+      default = [ ];
+      example = [ "https://clipshare.site-b.example.com" ];
+      description = "Base URLs of the servers every set, clear and expiry is replicated to.";
+    };
+
+    peerTokenFile = mkOption {
+      type = types.nullOr types.str;
+      default = null;
+      description = "File containing the bearer token shared by peers. Replication is disabled when unset.";
+    };
+
+    corsOrigins = mkOption {
+      type = types.listOf types.str;
+      default = [ ];
+      example = [ "chrome-extension://abcdefghijklmnopabcdefghijklmnop" ];
+      description = "Origins whose pages may call the API from a browser, e.g. a browser extension. `*` allows every origin.";
+    };
+
+    sensitiveTTL = mkOption {
+      type = types.nullOr types.str;
+      default = null;
+      example = "10s";
+      description = "How long content that looks like a secret is kept, as a Go duration. Defaults to 15 seconds.";
+    };
+
+    maxPinDuration = mkOption {
+      type = types.nullOr types.str;
+      default = null;
+      example = "24h";
+      description = "How long pinned content may be kept, as a Go duration. Defaults to 8 hours.";
+    };
+
+    trustedProxies = mkOption {
+      type = types.listOf types.str;
+      default = [ ];
+      example = [ "127.0.0.1" "::1" ];
+      description = "Addresses or CIDR prefixes of the proxies, such as `tailscale serve`, whose `Tailscale-User-Login` and `Tailscale-User-Name` headers are trusted. Authenticated users get private channels.";
+    };
+
+    persistSnippets = mkOption {
+      type = types.bool;
+      default = true;
+      description = "Whether to keep snippets across restarts, in the state directory `/var/lib/clipshare`.";
+    };
+
+    webhooksFile = mkOption {
+      type = types.nullOr types.str;
+      default = null;
+      description = "JSON file listing the webhook targets that clipboard events are sent to, with their secrets. See the README for its format.";
+    };
   };
 
   config = mkIf cfg.enable {
@@ -78,7 +143,8 @@ in
         ProtectKernelTunables = true;
         ProtectKernelModules = true;
         ProtectControlGroups = true;
-        RestrictAddressFamilies = [ "AF_INET" "AF_INET6" ];
+        # Listing the network interfaces to advertise needs netlink.
+        RestrictAddressFamilies = [ "AF_INET" "AF_INET6" ] ++ optional cfg.advertise "AF_NETLINK";
         RestrictNamespaces = true;
         LockPersonality = true;
         MemoryDenyWriteExecute = true;
@@ -86,16 +152,34 @@ in
         RestrictSUIDSGID = true;
         RemoveIPC = true;
         PrivateDevices = true;
+      } // optionalAttrs cfg.persistSnippets {
+        StateDirectory = "clipshare";
+        StateDirectoryMode = "0700";
+      } // optionalAttrs (cfg.peerTokenFile != null || cfg.webhooksFile != null) {
+        LoadCredential =
+          optional (cfg.peerTokenFile != null) "peer-token:${cfg.peerTokenFile}"
+          ++ optional (cfg.webhooksFile != null) "webhooks:${cfg.webhooksFile}";
       };
       
       environment = {
         HOST = cfg.host;
         PORT = toString cfg.port;
-      };
+      }
+      // optionalAttrs cfg.advertise { ADVERTISE = "true"; }
+      // optionalAttrs (cfg.origin != null) { ORIGIN = cfg.origin; }
+      // optionalAttrs (cfg.peers != [ ]) { PEERS = concatStringsSep "," cfg.peers; }
+      // optionalAttrs (cfg.peerTokenFile != null) { PEER_TOKEN_FILE = "%d/peer-token"; }
+      // optionalAttrs (cfg.corsOrigins != [ ]) { CORS_ORIGINS = concatStringsSep "," cfg.corsOrigins; }
+      // optionalAttrs (cfg.sensitiveTTL != null) { SENSITIVE_TTL = cfg.sensitiveTTL; }
+      // optionalAttrs (cfg.maxPinDuration != null) { MAX_PIN_DURATION = cfg.maxPinDuration; }
+      // optionalAttrs (cfg.trustedProxies != [ ]) { TRUSTED_PROXIES = concatStringsSep "," cfg.trustedProxies; }
+      // optionalAttrs (cfg.webhooksFile != null) { WEBHOOKS_FILE = "%d/webhooks"; }
+      // optionalAttrs cfg.persistSnippets { SNIPPETS_FILE = "%S/clipshare/snippets.json"; };
     };
 
     networking.firewall = mkIf cfg.openFirewall {
       allowedTCPPorts = [ cfg.port ];
+      allowedUDPPorts = optional cfg.advertise 5353;
     };
   };
 }
\ No newline at end of file
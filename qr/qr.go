@@ -0,0 +1,565 @@
+// Package qr encodes QR codes (ISO/IEC 18004, model 2) in byte mode.
+//
+//	code, err := qr.Encode([]byte("https://example.com"), qr.M)
+//	if err != nil {
+//		return err
+//	}
+//	png.Encode(w, code.Image(8))
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Level is the error correction level. Higher levels survive more damage
+// but need larger codes.
+type Level int
+
+// Error correction levels, recovering about 7%, 15%, 25% and 30% of the
+// code respectively.
+const (
+	L Level = iota
+	M
+	Q
+	H
+)
+
+func (l Level) String() string {
+	return [...]string{"L", "M", "Q", "H"}[l]
+}
+
+// ParseLevel parses "L", "M", "Q" or "H", in any case.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return L, nil
+	case "M":
+		return M, nil
+	case "Q":
+		return Q, nil
+	case "H":
+		return H, nil
+	}
+	return 0, fmt.Errorf("invalid error correction level %q (want L, M, Q or H)", s)
+}
+
+// ErrTooLong is returned when the data doesn't fit in the largest code.
+var ErrTooLong = errors.New("data too long for a QR code")
+
+// QuietZone is the width, in modules, of the light border around a code.
+const QuietZone = 4
+
+const (
+	minVersion = 1
+	maxVersion = 40
+)
+
+// Code is an encoded QR code.
+type Code struct {
+	// Size is the width and height of the code in modules, without the
+	// quiet zone.
+	Size    int
+	Version int
+	Level   Level
+
+	modules    []bool
+	isFunction []bool
+}
+
+// Black reports whether the module at column x and row y is dark. Modules
+// outside of the code, in the quiet zone, are light.
+func (c *Code) Black(x, y int) bool {
+	return x >= 0 && x < c.Size && y >= 0 && y < c.Size && c.modules[y*c.Size+x]
+}
+
+// Image renders the code with scale pixels per module, surrounded by the
+// quiet zone.
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+	side := (c.Size + 2*QuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := range side {
+		for x := range side {
+			if c.Black(x/scale-QuietZone, y/scale-QuietZone) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img
+}
+
+// Encode returns the smallest code holding data at the given error
+// correction level.
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < L || level > H {
+		return nil, fmt.Errorf("invalid error correction level %d", level)
+	}
+
+	version := minVersion
+	for ; version <= maxVersion; version++ {
+		if byteModeBits(version, len(data)) <= numDataCodewords(version, level)*8 {
+			break
+		}
+	}
+	if version > maxVersion {
+		return nil, ErrTooLong
+	}
+
+	c := newCode(version, level)
+	c.drawFunctionPatterns()
+	c.drawCodewords(c.addErrorCorrection(c.dataCodewords(data)))
+
+	best, minPenalty := 0, -1
+	for mask := range 8 {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if p := c.penalty(); minPenalty < 0 || p < minPenalty {
+			best, minPenalty = mask, p
+		}
+		c.applyMask(mask) // Masking twice undoes it.
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+
+	return c, nil
+}
+
+// encodeWithMask is Encode with a fixed mask, for tests.
+func encodeWithMask(data []byte, version int, level Level, mask int) *Code {
+	c := newCode(version, level)
+	c.drawFunctionPatterns()
+	c.drawCodewords(c.addErrorCorrection(c.dataCodewords(data)))
+	c.applyMask(mask)
+	c.drawFormatBits(mask)
+	return c
+}
+
+func newCode(version int, level Level) *Code {
+	size := version*4 + 17
+	return &Code{
+		Size:       size,
+		Version:    version,
+		Level:      level,
+		modules:    make([]bool, size*size),
+		isFunction: make([]bool, size*size),
+	}
+}
+
+// byteModeBits is the length of a byte mode segment of n bytes.
+func byteModeBits(version, n int) int {
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	return 4 + countBits + 8*n
+}
+
+// dataCodewords returns the data segment, terminated and padded to the
+// capacity of the code.
+func (c *Code) dataCodewords(data []byte) []byte {
+	var bb bitBuffer
+	bb.append(0x4, 4) // Byte mode.
+	if c.Version >= 10 {
+		bb.append(uint32(len(data)), 16)
+	} else {
+		bb.append(uint32(len(data)), 8)
+	}
+	for _, b := range data {
+		bb.append(uint32(b), 8)
+	}
+
+	capacity := numDataCodewords(c.Version, c.Level) * 8
+	bb.append(0, min(4, capacity-bb.len()))
+	bb.append(0, (8-bb.len()%8)%8)
+	for pad := uint32(0xec); bb.len() < capacity; pad ^= 0xec ^ 0x11 {
+		bb.append(pad, 8)
+	}
+	return bb.bytes()
+}
+
+// addErrorCorrection splits data into blocks, appends the error correction
+// codewords of each, and interleaves them.
+func (c *Code) addErrorCorrection(data []byte) []byte {
+	numBlocks := numErrorCorrectionBlocks[c.Level][c.Version]
+	blockECCLen := eccCodewordsPerBlock[c.Level][c.Version]
+	rawCodewords := numRawDataModules(c.Version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockECCLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		n := shortBlockLen - blockECCLen
+		if i >= numShortBlocks {
+			n++
+		}
+		block := append([]byte(nil), data[k:k+n]...)
+		k += n
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			block = append(block, 0) // Placeholder, skipped when interleaving.
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y*c.Size+x] = dark
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.set(x, y, dark)
+	c.isFunction[y*c.Size+x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := range c.Size {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinderPattern(3, 3)
+	c.drawFinderPattern(c.Size-4, 3)
+	c.drawFinderPattern(3, c.Size-4)
+
+	positions := alignmentPatternPositions(c.Version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Skip the corners taken by finder patterns.
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignmentPattern(x, y)
+		}
+	}
+
+	// Reserve the format bits; they are drawn once the mask is known.
+	c.drawFormatBits(0)
+	c.drawVersionBits()
+}
+
+// drawFinderPattern draws a finder pattern and its separator around the
+// center x, y.
+func (c *Code) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// formatBits returns the 15 format bits for the level and mask, protected
+// by a BCH code.
+func formatBits(level Level, mask int) uint32 {
+	// The level indicator bits are not in the order of the levels.
+	data := uint32([...]int{1, 0, 3, 2}[level]<<3 | mask)
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatBits(c.Level, mask)
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	// First copy, around the top left finder pattern.
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	// Second copy, split between the other two finder patterns.
+	for i := range 8 {
+		c.setFunction(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(i))
+	}
+	c.setFunction(8, c.Size-8, true) // Always dark.
+}
+
+// versionBits returns the 18 version bits, protected by a BCH code.
+func versionBits(version int) uint32 {
+	rem := uint32(version)
+	for range 12 {
+		rem = rem<<1 ^ (rem>>11)*0x1f25
+	}
+	return uint32(version)<<12 | rem
+}
+
+func (c *Code) drawVersionBits() {
+	if c.Version < 7 {
+		return
+	}
+
+	bits := versionBits(c.Version)
+	for i := range 18 {
+		dark := bits>>i&1 != 0
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, dark)
+		c.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places data in the zigzag order of the standard, in pairs
+// of columns from the bottom right, skipping function modules.
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern.
+		}
+		upward := (right+1)&2 == 0
+		for vert := range c.Size {
+			for j := range 2 {
+				x, y := right-j, vert
+				if upward {
+					y = c.Size - 1 - vert
+				}
+				if c.isFunction[y*c.Size+x] || i >= len(data)*8 {
+					continue
+				}
+				c.set(x, y, data[i>>3]>>(7-i&7)&1 != 0)
+				i++
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules selected by mask. Applying the same mask
+// twice restores them.
+func (c *Code) applyMask(mask int) {
+	for y := range c.Size {
+		for x := range c.Size {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			i := y*c.Size + x
+			if invert && !c.isFunction[i] {
+				c.modules[i] = !c.modules[i]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to scan, following the four rules of
+// the standard used to pick a mask.
+func (c *Code) penalty() int {
+	result := 0
+
+	// Rules 1 and 3: runs of the same color, and patterns looking like
+	// finder patterns, in rows and columns.
+	for _, column := range []bool{false, true} {
+		for a := range c.Size {
+			line := make([]bool, c.Size)
+			for b := range c.Size {
+				if column {
+					line[b] = c.Black(a, b)
+				} else {
+					line[b] = c.Black(b, a)
+				}
+			}
+			result += linePenalty(line)
+		}
+	}
+
+	// Rule 2: 2x2 blocks of the same color.
+	for y := 0; y < c.Size-1; y++ {
+		for x := 0; x < c.Size-1; x++ {
+			color := c.Black(x, y)
+			if color == c.Black(x+1, y) && color == c.Black(x, y+1) && color == c.Black(x+1, y+1) {
+				result += 3
+			}
+		}
+	}
+
+	// Rule 4: imbalance between dark and light modules, 10 points for every
+	// 5% away from half.
+	dark := 0
+	for _, m := range c.modules {
+		if m {
+			dark++
+		}
+	}
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	result += max(k, 0) * 10
+
+	return result
+}
+
+var finderLike = [][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+func linePenalty(line []bool) int {
+	result := 0
+
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			result += 3 + run - 5
+		}
+		run = 1
+	}
+
+	for i := 0; i+11 <= len(line); i++ {
+		for _, pattern := range finderLike {
+			match := true
+			for j, dark := range pattern {
+				if line[i+j] != dark {
+					match = false
+					break
+				}
+			}
+			if match {
+				result += 40
+			}
+		}
+	}
+
+	return result
+}
+
+// alignmentPatternPositions returns the centers of the alignment patterns,
+// in both directions, evenly spaced from the bottom right.
+func alignmentPatternPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	result := make([]int, numAlign)
+	result[0] = 6
+	for i, pos := numAlign-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+// numRawDataModules is the number of modules available for data and error
+// correction codewords, after function patterns.
+func numRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// numDataCodewords is the number of data codewords, after error correction.
+func numDataCodewords(version int, level Level) int {
+	return numRawDataModules(version)/8 - eccCodewordsPerBlock[level][version]*numErrorCorrectionBlocks[level][version]
+}
+
+type bitBuffer struct {
+	data []byte
+	n    int
+}
+
+func (bb *bitBuffer) len() int {
+	return bb.n
+}
+
+// append appends the low n bits of v, most significant first.
+func (bb *bitBuffer) append(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if bb.n%8 == 0 {
+			bb.data = append(bb.data, 0)
+		}
+		if v>>i&1 != 0 {
+			bb.data[bb.n/8] |= 0x80 >> (bb.n % 8)
+		}
+		bb.n++
+	}
+}
+
+func (bb *bitBuffer) bytes() []byte {
+	return bb.data
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// eccCodewordsPerBlock and numErrorCorrectionBlocks are indexed by level and
+// version; version 0 is unused.
+var eccCodewordsPerBlock = [4][41]int{
+	{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var numErrorCorrectionBlocks = [4][41]int{
+	{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
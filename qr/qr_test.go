@@ -0,0 +1,229 @@
+package qr
+
+import (
+	"errors"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// golden is "https://example.com" at version 2, level M, mask 2, as encoded
+// by an independent implementation.
+var golden = []string{
+	"#######....###..#.#######",
+	"#.....#...#..####.#.....#",
+	"#.###.#.##.#..#...#.###.#",
+	"#.###.#.#....###..#.###.#",
+	"#.###.#.###..#..#.#.###.#",
+	"#.....#.#..#..##..#.....#",
+	"#######.#.#.#.#.#.#######",
+	"........#.....#.#........",
+	"#.#####.....#.....#####..",
+	".#..##..#.##.#...#.#...#.",
+	"#####.#.##...####..#.#.##",
+	"##.###..#.##.#.##.##....#",
+	".###..#....##.##.##.#.###",
+	"#####...#.#.....#..#.#.#.",
+	"#.....##..###..#..####.##",
+	"#..#...#...#..#######...#",
+	"#.#..##.####....#####.#..",
+	"........##..#####...##...",
+	"#######......##.#.#.#.###",
+	"#.....#.##..##..#...##.#.",
+	"#.###.#.###.#.#######.#.#",
+	"#.###.#.#......#.##.#####",
+	"#.###.#.#####..#.....##.#",
+	"#.....#....#..#.##.###..#",
+	"#######.##.#.....########",
+}
+
+func render(c *Code) []string {
+	var rows []string
+	for y := range c.Size {
+		var sb strings.Builder
+		for x := range c.Size {
+			if c.Black(x, y) {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		rows = append(rows, sb.String())
+	}
+	return rows
+}
+
+func TestGolden(t *testing.T) {
+	c := encodeWithMask([]byte("https://example.com"), 2, M, 2)
+	got := render(c)
+	for y := range golden {
+		if got[y] != golden[y] {
+			t.Errorf("row %d: expected %s, got %s", y, golden[y], got[y])
+		}
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	// From the table in annex C of the standard.
+	expected := map[Level][8]uint32{
+		L: {0x77c4, 0x72f3, 0x7daa, 0x789d, 0x662f, 0x6318, 0x6c41, 0x6976},
+		M: {0x5412, 0x5125, 0x5e7c, 0x5b4b, 0x45f9, 0x40ce, 0x4f97, 0x4aa0},
+		Q: {0x355f, 0x3068, 0x3f31, 0x3a06, 0x24b4, 0x2183, 0x2eda, 0x2bed},
+		H: {0x1689, 0x13be, 0x1ce7, 0x19d0, 0x0762, 0x0255, 0x0d0c, 0x083b},
+	}
+	for level, bits := range expected {
+		for mask, want := range bits {
+			if got := formatBits(level, mask); got != want {
+				t.Errorf("level %s, mask %d: expected %#x, got %#x", level, mask, want, got)
+			}
+		}
+	}
+}
+
+func TestVersionBits(t *testing.T) {
+	for version, want := range map[int]uint32{7: 0x07c94, 21: 0x15683, 40: 0x28c69} {
+		if got := versionBits(version); got != want {
+			t.Errorf("version %d: expected %#x, got %#x", version, want, got)
+		}
+	}
+}
+
+func TestAlignmentPatternPositions(t *testing.T) {
+	for version, want := range map[int][]int{
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		16: {6, 26, 50, 74},
+		32: {6, 34, 60, 86, 112, 138},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	} {
+		got := alignmentPatternPositions(version)
+		if len(got) != len(want) {
+			t.Errorf("version %d: expected %v, got %v", version, want, got)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("version %d: expected %v, got %v", version, want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	// Byte mode capacities of the smallest and largest versions.
+	for _, tt := range []struct {
+		version int
+		level   Level
+		bytes   int
+	}{
+		{1, L, 17}, {1, M, 14}, {1, Q, 11}, {1, H, 7},
+		{40, L, 2953}, {40, M, 2331}, {40, Q, 1663}, {40, H, 1273},
+	} {
+		c, err := Encode(make([]byte, tt.bytes), tt.level)
+		if err != nil || c.Version != tt.version {
+			t.Errorf("%d bytes at level %s: expected version %d, got %+v, %v", tt.bytes, tt.level, tt.version, c, err)
+		}
+		if tt.version == 1 {
+			if c, _ := Encode(make([]byte, tt.bytes+1), tt.level); c.Version != 2 {
+				t.Errorf("%d bytes at level %s: expected version 2, got %d", tt.bytes+1, tt.level, c.Version)
+			}
+		}
+	}
+
+	if _, err := Encode(make([]byte, 2954), L); !errors.Is(err, ErrTooLong) {
+		t.Errorf("expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	// The codeword polynomial must vanish at every root of the generator.
+	data := []byte("clipshare error correction")
+	ecc := reedSolomonRemainder(data, reedSolomonDivisor(10))
+	codeword := append(data, ecc...)
+
+	root := byte(1)
+	for i := range 10 {
+		var v byte
+		for _, b := range codeword {
+			v = gfMultiply(v, root) ^ b
+		}
+		if v != 0 {
+			t.Errorf("syndrome %d is %#x", i, v)
+		}
+		root = gfMultiply(root, 0x02)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	c, err := Encode([]byte("WIFI:S:home;T:WPA;P:hunter2;;"), H)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if c.Size != c.Version*4+17 || c.Level != H {
+		t.Errorf("unexpected code %+v", c)
+	}
+
+	// Finder pattern corners and the timing pattern.
+	for _, p := range [][2]int{{0, 0}, {c.Size - 1, 0}, {0, c.Size - 1}, {6, 6}} {
+		if !c.Black(p[0], p[1]) {
+			t.Errorf("expected a dark module at %v", p)
+		}
+	}
+	if c.Black(7, 7) || c.Black(-1, 0) || c.Black(c.Size, 0) {
+		t.Error("expected light separator and quiet zone")
+	}
+
+	// The selected mask is recorded in the format bits.
+	var bits uint32
+	for i := 14; i >= 9; i-- {
+		bits = bits<<1 | b2u(c.Black(14-i, 8))
+	}
+	bits = bits<<1 | b2u(c.Black(7, 8))
+	bits = bits<<1 | b2u(c.Black(8, 8))
+	bits = bits<<1 | b2u(c.Black(8, 7))
+	for i := 5; i >= 0; i-- {
+		bits = bits<<1 | b2u(c.Black(8, i))
+	}
+	found := false
+	for mask := range 8 {
+		found = found || bits == formatBits(H, mask)
+	}
+	if !found {
+		t.Errorf("format bits %#x don't match level H", bits)
+	}
+}
+
+func b2u(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestImage(t *testing.T) {
+	c, _ := Encode([]byte("hello"), M)
+	img := c.Image(3)
+
+	side := (c.Size + 2*QuietZone) * 3
+	if b := img.Bounds(); b.Dx() != side || b.Dy() != side {
+		t.Fatalf("expected a %dx%d image, got %v", side, side, b)
+	}
+	if img.At(0, 0) != color.White {
+		t.Error("expected a light quiet zone")
+	}
+	if origin := QuietZone * 3; img.At(origin+2, origin+2) != color.Black {
+		t.Error("expected the top left finder pattern")
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"l": L, "M": M, "q": Q, "H": H} {
+		if got, err := ParseLevel(s); err != nil || got != want {
+			t.Errorf("%q: expected %s, got %s, %v", s, want, got, err)
+		}
+	}
+	if _, err := ParseLevel("X"); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+}
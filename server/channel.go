@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// DefaultChannel is used by requests that don't name a channel.
+const DefaultChannel = "default"
+
+const maxChannelLength = 64
+
+// channelFromRequest returns the key of the channel named by the "channel"
+// query parameter, or DefaultChannel, scoped to the user of the request if
+// any. It reports false for invalid names.
+func channelFromRequest(r *http.Request) (string, bool) {
+	channel := r.URL.Query().Get("channel")
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	if user, ok := userFromRequest(r); ok {
+		return scopeChannel(user, channel), validChannel(channel)
+	}
+	return channel, validChannel(channel)
+}
+
+// validChannel accepts names made of letters, digits, '.', '_' and '-'.
+func validChannel(name string) bool {
+	if len(name) > maxChannelLength {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Channels returns the keys of the channels holding content, sorted. The
+// private channels of users are named "login/channel".
+func (s *Server) Channels() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.channels))
+	for name := range s.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// channelsOf returns the names of the channels that the user of r, or
+// anonymous users, can see, sorted.
+func (s *Server) channelsOf(r *http.Request) []string {
+	user, _ := userFromRequest(r)
+	names := []string{}
+	for _, key := range s.Channels() {
+		if channelScope(key) == user.Login {
+			names = append(names, channelName(key))
+		}
+	}
+	return names
+}
+
+func (s *Server) channelsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.channelsOf(r))
+}
@@ -0,0 +1,25 @@
+package server
+
+import "time"
+
+// Clock abstracts time so that expiry can be driven deterministically in
+// tests.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is the subset of *time.Timer used by the server.
+type Timer interface {
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	corsAllowMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	corsAllowHeaders = "Content-Type, Authorization, " + DeviceHeader
+	// corsExposeHeaders are the metadata headers scripts may read.
+	corsExposeHeaders = "Content-Disposition, " + DeviceHeader + ", " + ExpiresHeader + ", " + SensitiveHeader + ", " + PinnedHeader
+	// corsMaxAge is how long browsers may cache a preflight, in seconds.
+	corsMaxAge = "600"
+)
+
+// isAPIPath reports whether path is part of the REST API, which is the only
+// part of the server shared with other origins.
+func isAPIPath(path string) bool {
+	return path == "/clipboard" || strings.HasPrefix(path, "/clipboard/") || path == "/channels" ||
+		path == "/snippets" || strings.HasPrefix(path, "/snippets/") || path == "/api" || strings.HasPrefix(path, "/api/")
+}
+
+// allowsOrigin reports whether origin may call the API from a browser.
+func (s *Server) allowsOrigin(origin string) bool {
+	return s.allowedOrigins["*"] || s.allowedOrigins[strings.TrimSuffix(origin, "/")]
+}
+
+// handleCORS adds the CORS headers for requests from allowed origins, and
+// answers their preflight requests. It reports whether r was answered.
+func (s *Server) handleCORS(w http.ResponseWriter, r *http.Request) bool {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+
+	h.Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+	h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+
+	h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+	h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+	h.Set("Access-Control-Max-Age", corsMaxAge)
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCORSServer(t *testing.T, origins ...string) *Server {
+	t.Helper()
+	return New(Options{TTL: time.Minute, Clock: newFakeClock(), AllowedOrigins: origins})
+}
+
+func TestCORSDisabledByDefault(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodOptions, "/clipboard", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("expected no CORS headers by default")
+	}
+	if w.Code == http.StatusNoContent {
+		t.Error("expected the preflight to fail by default")
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	s := newCORSServer(t, "https://example.com/", "chrome-extension://abcdef")
+
+	for _, origin := range []string{"https://example.com", "chrome-extension://abcdef"} {
+		req := httptest.NewRequest(http.MethodOptions, "/clipboard?channel=work", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%s: expected status %d, got %d", origin, http.StatusNoContent, w.Code)
+		}
+		for header, want := range map[string]string{
+			"Access-Control-Allow-Origin":  origin,
+			"Access-Control-Allow-Methods": corsAllowMethods,
+			"Access-Control-Allow-Headers": corsAllowHeaders,
+			"Access-Control-Max-Age":       corsMaxAge,
+			"Vary":                         "Origin",
+		} {
+			if got := w.Header().Get(header); got != want {
+				t.Errorf("%s: expected %s %q, got %q", origin, header, want, got)
+			}
+		}
+	}
+}
+
+func TestCORSRequests(t *testing.T) {
+	s := newCORSServer(t, "https://example.com")
+
+	// An allowed origin can write, even cross-site.
+	req := httptest.NewRequest(http.MethodPost, "/clipboard", strings.NewReader(`{"text":"https://example.com/page"}`))
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("expected Access-Control-Allow-Origin https://example.com, got %q", got)
+	}
+	if s.Content(DefaultChannel) != "https://example.com/page" {
+		t.Errorf("unexpected content %q", s.Content(DefaultChannel))
+	}
+
+	// Other origins are still rejected, and get no CORS headers.
+	req = httptest.NewRequest(http.MethodPost, "/clipboard", strings.NewReader(`{"text":"evil"}`))
+	req.Header.Set("Origin", "https://evil.example")
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("expected no CORS headers for another origin")
+	}
+
+	// Only the API is shared.
+	for _, path := range []string{"/", "/share", "/sw.js"} {
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Origin", "https://example.com")
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: expected no CORS headers outside of the API", path)
+		}
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	s := newCORSServer(t, "*")
+
+	req := httptest.NewRequest(http.MethodGet, "/channels", nil)
+	req.Header.Set("Origin", "https://anywhere.example")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://anywhere.example" {
+		t.Errorf("expected the origin to be allowed, got %q", got)
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/aldur/clipshare/envelope"
+)
+
+// cryptoJSRunner loads static/crypto.js and answers requests read from
+// stdin: it opens the envelopes sealed by Go, and seals content for Go to
+// open.
+const cryptoJSRunner = `
+const fs = require('fs');
+const vm = require('vm');
+vm.runInThisContext(fs.readFileSync(process.argv[2], 'utf8'));
+
+(async () => {
+    const input = JSON.parse(fs.readFileSync(0, 'utf8'));
+    const output = {opened: [], sealed: []};
+    for (const {envelope, passphrase} of input.open) {
+        output.opened.push(await openContent(envelope, passphrase));
+    }
+    for (const {content, passphrase} of input.seal) {
+        output.sealed.push(await sealContent(content, passphrase));
+    }
+    console.log(JSON.stringify(output));
+})().catch((error) => {
+    console.error(error);
+    process.exit(1);
+});
+`
+
+type jsContent struct {
+	Text     string `json:"text,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+}
+
+// TestCryptoJSInterop checks that the web UI and the envelope package read
+// each other's envelopes. It needs node, which ships WebCrypto.
+func TestCryptoJSInterop(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not found")
+	}
+
+	dir := t.TempDir()
+	script, err := static.ReadFile("static/crypto.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "crypto.js"), script, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "runner.js"), []byte(cryptoJSRunner), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	contents := []jsContent{
+		{Text: "hello from Go ✓"},
+		{Data: []byte{0x89, 'P', 'N', 'G', 0, 0xff}, Filename: "shot.png", MIMEType: "image/png"},
+	}
+	const passphrase = "pässwörd 🔑"
+
+	type item struct {
+		Envelope   string    `json:"envelope,omitempty"`
+		Content    jsContent `json:"content"`
+		Passphrase string    `json:"passphrase"`
+	}
+	var input struct {
+		Open []item `json:"open"`
+		Seal []item `json:"seal"`
+	}
+	for _, c := range contents {
+		plaintext, _ := json.Marshal(c)
+		sealed, err := envelope.Seal(plaintext, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input.Open = append(input.Open, item{Envelope: sealed, Passphrase: passphrase})
+		input.Seal = append(input.Seal, item{Content: c, Passphrase: passphrase})
+	}
+	stdin, _ := json.Marshal(input)
+
+	cmd := exec.Command(node, filepath.Join(dir, "runner.js"), filepath.Join(dir, "crypto.js"))
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("node failed: %v", err)
+	}
+
+	var output struct {
+		Opened []jsContent `json:"opened"`
+		Sealed []string    `json:"sealed"`
+	}
+	if err := json.Unmarshal(out, &output); err != nil {
+		t.Fatalf("invalid output %q: %v", out, err)
+	}
+
+	for i, want := range contents {
+		got := output.Opened[i]
+		if got.Text != want.Text || !bytes.Equal(got.Data, want.Data) || got.Filename != want.Filename || got.MIMEType != want.MIMEType {
+			t.Errorf("crypto.js opened %+v, want %+v", got, want)
+		}
+
+		plaintext, err := envelope.Open(output.Sealed[i], passphrase)
+		if err != nil {
+			t.Fatalf("failed to open the envelope sealed by crypto.js: %v", err)
+		}
+		var c jsContent
+		if err := json.Unmarshal(plaintext, &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Text != want.Text || !bytes.Equal(c.Data, want.Data) || c.Filename != want.Filename || c.MIMEType != want.MIMEType {
+			t.Errorf("crypto.js sealed %+v, want %+v", c, want)
+		}
+	}
+}
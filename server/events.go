@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// subscriberBuffer is how many events a slow subscriber may lag behind before
+// further events are dropped for it.
+const subscriberBuffer = 16
+
+// Subscribe returns a channel receiving every change of a clipboard channel,
+// starting with a snapshot of its current content. Call the returned
+// function to unsubscribe.
+func (s *Server) Subscribe(channel string) (<-chan api.Event, func()) {
+	ch := make(chan api.Event, subscriberBuffer)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.channels[channel]; ok {
+		ch <- c.event(api.EventSnapshot, channel)
+	} else {
+		ch <- Entry{}.event(api.EventSnapshot, channel)
+	}
+	s.subscribers[ch] = channel
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish must be called with s.mu held.
+func (s *Server) publish(ev api.Event) {
+	for ch, channel := range s.subscribers {
+		if channel != ev.Channel {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	channel, ok := channelFromRequest(r)
+	if !ok {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := s.Subscribe(channel)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-events:
+			ev.Channel = channelName(ev.Channel)
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
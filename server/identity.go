@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// Headers set by Tailscale Serve on the requests of authenticated users.
+// They are only honored from Options.TrustedProxies.
+const (
+	UserLoginHeader = "Tailscale-User-Login"
+	UserNameHeader  = "Tailscale-User-Name"
+)
+
+// maxLoginLength bounds the logins that scope channels.
+const maxLoginLength = 256
+
+// userKey is the context key of the user of a request.
+type userKey struct{}
+
+// trusts reports whether r comes straight from a trusted proxy.
+func (s *Server) trusts(r *http.Request) bool {
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := addr.Addr().Unmap()
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// identify returns r with the user that a trusted proxy authenticated it as,
+// if any. Identity headers from anywhere else are ignored, since any client
+// could set them.
+func (s *Server) identify(r *http.Request) *http.Request {
+	login := strings.TrimSpace(r.Header.Get(UserLoginHeader))
+	if login == "" || !validLogin(login) || !s.trusts(r) {
+		return r
+	}
+
+	// Tailscale encodes non-ASCII names as MIME encoded-words.
+	name := r.Header.Get(UserNameHeader)
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = decoded
+	}
+
+	user := api.User{Login: login, Name: strings.TrimSpace(name)}
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, user))
+}
+
+// userFromRequest returns the authenticated user of r, reporting false for
+// anonymous requests.
+func userFromRequest(r *http.Request) (api.User, bool) {
+	user, ok := r.Context().Value(userKey{}).(api.User)
+	return user, ok
+}
+
+// validLogin accepts logins without slashes, spaces or control characters,
+// so that they can scope channel names.
+func validLogin(login string) bool {
+	if len(login) > maxLoginLength {
+		return false
+	}
+	for _, r := range login {
+		if r <= ' ' || r == 0x7f || r == '/' {
+			return false
+		}
+	}
+	return true
+}
+
+// scopeChannel returns the key that stores the channel of user: channels of
+// authenticated users are private, and named "login/channel".
+func scopeChannel(user api.User, channel string) string {
+	return user.Login + "/" + channel
+}
+
+// channelName returns the name of the channel stored under key, without
+// the login of its user.
+func channelName(key string) string {
+	return key[strings.LastIndexByte(key, '/')+1:]
+}
+
+// channelScope returns the login that key is scoped to, or "" for shared
+// channels.
+func channelScope(key string) string {
+	if i := strings.LastIndexByte(key, '/'); i >= 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+// validChannelKey accepts the names of shared channels and the keys of
+// private ones.
+func validChannelKey(key string) bool {
+	name := channelName(key)
+	if name == "" || !validChannel(name) {
+		return false
+	}
+	if name == key {
+		return true
+	}
+	scope := channelScope(key)
+	return scope != "" && validLogin(scope)
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+const proxyAddr = "127.0.0.1:41234"
+
+func newProxiedServer(t *testing.T) *Server {
+	t.Helper()
+
+	return New(Options{
+		TTL:            time.Minute,
+		Clock:          newFakeClock(),
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32"), netip.MustParsePrefix("::1/128")},
+	})
+}
+
+// proxied returns a request for target, as forwarded by Tailscale Serve for
+// login from remoteAddr.
+func proxied(method, target, body, remoteAddr, login string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	if login != "" {
+		req.Header.Set(UserLoginHeader, login)
+		req.Header.Set(UserNameHeader, "=?utf-8?q?Zo=C3=AB?=")
+	}
+	return req
+}
+
+func TestTrustedProxyIdentity(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		login      string
+		wantKey    string
+		wantUser   api.User
+	}{
+		{"trusted", proxyAddr, "zoe@example.com", "zoe@example.com/default", api.User{Login: "zoe@example.com", Name: "Zoë"}},
+		{"trusted IPv6", "[::1]:41234", "zoe@example.com", "zoe@example.com/default", api.User{Login: "zoe@example.com", Name: "Zoë"}},
+		{"IPv4-mapped", "[::ffff:127.0.0.1]:41234", "zoe@example.com", "zoe@example.com/default", api.User{Login: "zoe@example.com", Name: "Zoë"}},
+		{"untrusted", "192.0.2.1:41234", "zoe@example.com", DefaultChannel, api.User{}},
+		{"anonymous", proxyAddr, "", DefaultChannel, api.User{}},
+		{"invalid login", proxyAddr, "zoe/example", DefaultChannel, api.User{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newProxiedServer(t)
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, proxied(http.MethodPost, "/clipboard", `{"text":"hello","device":"laptop"}`, tt.remoteAddr, tt.login))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			if got := s.Channels(); !reflect.DeepEqual(got, []string{tt.wantKey}) {
+				t.Fatalf("expected channel %q, got %v", tt.wantKey, got)
+			}
+			e, _ := s.Get(tt.wantKey)
+			if e.User != tt.wantUser || e.Device != "laptop" {
+				t.Errorf("expected user %+v from laptop, got %+v from %q", tt.wantUser, e.User, e.Device)
+			}
+		})
+	}
+}
+
+func TestPrivateChannels(t *testing.T) {
+	s := newProxiedServer(t)
+	s.Set(DefaultChannel, "shared", "laptop")
+	s.Set("zoe@example.com/default", "zoe's", "laptop")
+	s.Set("zoe@example.com/work", "zoe's work", "laptop")
+	s.Set("max@example.com/default", "max's", "laptop")
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, proxied(http.MethodGet, "/api/v1/clipboard", "", proxyAddr, "zoe@example.com"))
+	var clip api.Clip
+	if err := json.Unmarshal(w.Body.Bytes(), &api.Response{Data: &clip}); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if clip.Channel != DefaultChannel || clip.Text != "zoe's" {
+		t.Errorf("expected zoe's default channel, got %+v", clip)
+	}
+
+	channels := func(r *http.Request) []string {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		var names []string
+		if err := json.Unmarshal(w.Body.Bytes(), &names); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return names
+	}
+	if got := channels(proxied(http.MethodGet, "/channels", "", proxyAddr, "zoe@example.com")); !reflect.DeepEqual(got, []string{"default", "work"}) {
+		t.Errorf("expected zoe's channels, got %v", got)
+	}
+	if got := channels(proxied(http.MethodGet, "/channels", "", proxyAddr, "")); !reflect.DeepEqual(got, []string{"default"}) {
+		t.Errorf("expected the shared channels, got %v", got)
+	}
+
+	// The page links to the channel by its name, not by its key.
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, proxied(http.MethodGet, "/?channel=work", "", proxyAddr, "zoe@example.com"))
+	if body := w.Body.String(); !strings.Contains(body, `data-channel="work"`) || !strings.Contains(body, "zoe&#39;s work") {
+		t.Errorf("expected zoe's work channel, got %s", body)
+	}
+}
+
+func TestValidChannelKey(t *testing.T) {
+	tests := map[string]bool{
+		"default":                 true,
+		"zoe@example.com/default": true,
+		"zoe@github/work.1":       true,
+		"":                        false,
+		"/default":                false,
+		"zoe@example.com/":        false,
+		"zoe@example.com/a b":     false,
+		"zoe example/default":     false,
+		"a/b/c":                   false,
+	}
+	for key, want := range tests {
+		if got := validChannelKey(key); got != want {
+			t.Errorf("validChannelKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
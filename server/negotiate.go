@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// ExpiresHeader carries when the content will be cleared, in RFC 3339
+// format. It is not sent for empty channels.
+const ExpiresHeader = "X-Clipshare-Expires"
+
+// SensitiveHeader is set to "true" when the content looks like a secret.
+const SensitiveHeader = "X-Clipshare-Sensitive"
+
+// PinnedHeader is set to "true" while the content is pinned.
+const PinnedHeader = "X-Clipshare-Pinned"
+
+// fragmentTemplate renders text content as an HTML fragment, to embed in
+// other pages.
+var fragmentTemplate = template.Must(template.New("fragment").Parse(
+	`<pre class="clipshare" data-channel="{{.Channel}}"{{with .Device}} data-device="{{.}}"{{end}}>{{.Text}}</pre>` + "\n"))
+
+// inlineTypes are the media types of raw content that browsers may show
+// inline: they can't run scripts. Other content is always downloaded.
+var inlineTypes = map[string]bool{
+	TextMIMEType: true,
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// isInlineType reports whether raw content of mimeType may be shown inline.
+func isInlineType(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	return err == nil && inlineTypes[mediaType]
+}
+
+// isActiveType reports whether browsers may run scripts in content of
+// mimeType, even when downloading it, such as HTML, SVG and JavaScript.
+// Invalid types are assumed active.
+func isActiveType(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return true
+	}
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/xml", "application/xml",
+		"text/javascript", "application/javascript", "application/x-javascript",
+		"text/ecmascript", "application/ecmascript":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+xml")
+}
+
+// mediaRange is a media range of an Accept header, with its quality.
+type mediaRange struct {
+	typ     string
+	quality float64
+}
+
+// parseAccept parses an Accept header. Invalid ranges are skipped.
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		typ, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{typ, q})
+	}
+	return ranges
+}
+
+// quality returns the quality of the most specific range matching offer, or
+// 0 if none does. The parameters of offer, such as its charset, are ignored.
+func quality(ranges []mediaRange, offer string) float64 {
+	mediaType, _, err := mime.ParseMediaType(offer)
+	if err != nil {
+		return 0
+	}
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		var s int
+		switch {
+		case r.typ == mediaType:
+			s = 2
+		case strings.HasSuffix(r.typ, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(r.typ, "*")):
+			s = 1
+		case r.typ == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = r.quality, s
+		}
+	}
+	return q
+}
+
+// negotiate returns the offer the Accept header of r prefers, favoring
+// earlier offers on ties, or false if none is acceptable. Without an Accept
+// header, the first offer is picked.
+func negotiate(r *http.Request, offers ...string) (string, bool) {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return offers[0], true
+	}
+
+	ranges := parseAccept(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := quality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// writeContent answers a GET or HEAD of a channel with its raw content, a
+// JSON envelope or, for text, an HTML fragment, as negotiated with Accept.
+// Metadata is sent in headers.
+func (s *Server) writeContent(w http.ResponseWriter, r *http.Request, channel string) {
+	e, expiresAt, pinned, found := s.lookup(channel)
+	mimeType := e.MIMEType
+	if !found {
+		mimeType = TextMIMEType
+	}
+	// Uploads can claim any type: those that could run scripts on the
+	// origin of the web UI are only served as opaque bytes.
+	if isActiveType(mimeType) {
+		mimeType = "application/octet-stream"
+	}
+
+	offers := []string{mimeType, "application/json"}
+	if strings.HasPrefix(mimeType, "text/") {
+		offers = append(offers, "text/html")
+	}
+	h := w.Header()
+	h.Add("Vary", "Accept")
+
+	var body []byte
+	switch typ, ok := negotiate(r, offers...); {
+	case !ok:
+		http.Error(w, "Not acceptable", http.StatusNotAcceptable)
+		return
+
+	case typ == "application/json" && mimeType != typ:
+		body, _ = json.Marshal(api.Response{Data: newClip(channel, e, expiresAt, pinned)})
+		h.Set("Content-Type", "application/json")
+
+	case typ == "text/html" && mimeType != typ:
+		var buf bytes.Buffer
+		fragmentTemplate.Execute(&buf, newClip(channel, e, expiresAt, pinned))
+		body = buf.Bytes()
+		h.Set("Content-Type", "text/html; charset=utf-8")
+
+	default:
+		body = e.Data
+		h.Set("Content-Security-Policy", rawContentPolicy)
+		if mimeType == TextMIMEType {
+			h.Set("Content-Type", TextMIMEType+"; charset=utf-8")
+		} else {
+			h.Set("Content-Type", mimeType)
+		}
+		if e.Filename != "" || !isInlineType(mimeType) {
+			params := map[string]string{}
+			if e.Filename != "" {
+				params["filename"] = e.Filename
+			}
+			h.Set("Content-Disposition", mime.FormatMediaType("attachment", params))
+		}
+	}
+
+	if e.Device != "" {
+		h.Set(DeviceHeader, e.Device)
+	}
+	if e.Sensitive {
+		h.Set(SensitiveHeader, "true")
+	}
+	if pinned {
+		h.Set(PinnedHeader, "true")
+	}
+	if !expiresAt.IsZero() {
+		h.Set(ExpiresHeader, expiresAt.UTC().Format(time.RFC3339))
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// browserAccept is what browsers send when navigating.
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		offers []string
+		want   string
+	}{
+		{"", []string{"text/plain", "application/json"}, "text/plain"},
+		{"*/*", []string{"text/plain", "application/json"}, "text/plain"},
+		{"application/json", []string{"text/plain", "application/json"}, "application/json"},
+		{"text/*;q=0.5, application/json;q=0.4", []string{"text/plain", "application/json"}, "text/plain"},
+		{"text/*, text/plain;q=0", []string{"text/plain", "text/html"}, "text/html"},
+		{browserAccept, []string{"text/plain", "application/json", "text/html"}, "text/html"},
+		{browserAccept, []string{"application/pdf", "application/json"}, "application/pdf"},
+		{"image/png", []string{"text/plain", "application/json"}, ""},
+		{"application/json;q=2, text/plain", []string{"application/json", "text/plain"}, "text/plain"},
+		{"text/plain", []string{"text/plain; charset=utf-8", "application/json"}, "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/clipboard", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		got, ok := negotiate(req, tt.offers...)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("negotiate(%q, %v) = %q, %v; want %q", tt.accept, tt.offers, got, ok, tt.want)
+		}
+	}
+}
+
+func getClipboard(t *testing.T, s *Server, method, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/clipboard", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestClipboardNegotiation(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Set(DefaultChannel, "<b>hi</b>", "laptop")
+
+	w := getClipboard(t, s, http.MethodGet, "application/json")
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %s", ct)
+	}
+	var clip api.Clip
+	if err := json.Unmarshal(w.Body.Bytes(), &api.Response{Data: &clip}); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := api.Clip{
+		Channel:   DefaultChannel,
+		Text:      "<b>hi</b>",
+		MIMEType:  TextMIMEType,
+		Device:    "laptop",
+		ExpiresAt: time.Date(2025, 1, 1, 0, 1, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(clip, want) {
+		t.Errorf("expected %+v, got %+v", want, clip)
+	}
+
+	w = getClipboard(t, s, http.MethodGet, browserAccept)
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("expected Content-Type text/html, got %s", ct)
+	}
+	fragment := `<pre class="clipshare" data-channel="default" data-device="laptop">&lt;b&gt;hi&lt;/b&gt;</pre>` + "\n"
+	if w.Body.String() != fragment {
+		t.Errorf("expected fragment %q, got %q", fragment, w.Body)
+	}
+
+	w = getClipboard(t, s, http.MethodGet, "text/plain")
+	if w.Body.String() != "<b>hi</b>" || w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("expected the raw text, got %q as %s", w.Body, w.Header().Get("Content-Type"))
+	}
+	if vary := w.Header().Values("Vary"); len(vary) != 1 || vary[0] != "Accept" {
+		t.Errorf("expected Vary: Accept, got %v", vary)
+	}
+
+	w = getClipboard(t, s, http.MethodGet, "image/png")
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("expected status %d, got %d", http.StatusNotAcceptable, w.Code)
+	}
+}
+
+func TestClipboardNegotiationFile(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.SetEntry(DefaultChannel, Entry{Data: []byte("%PDF"), Filename: "a.pdf", MIMEType: "application/pdf"})
+
+	// Browsers following download links get the file, not a fragment.
+	w := getClipboard(t, s, http.MethodGet, browserAccept)
+	if w.Body.String() != "%PDF" || w.Header().Get("Content-Type") != "application/pdf" {
+		t.Errorf("expected the raw file, got %q as %s", w.Body, w.Header().Get("Content-Type"))
+	}
+
+	w = getClipboard(t, s, http.MethodGet, "text/html")
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("expected status %d for an HTML file fragment, got %d", http.StatusNotAcceptable, w.Code)
+	}
+
+	w = getClipboard(t, s, http.MethodGet, "application/json")
+	var clip api.Clip
+	json.Unmarshal(w.Body.Bytes(), &api.Response{Data: &clip})
+	if string(clip.Data) != "%PDF" || clip.Filename != "a.pdf" {
+		t.Errorf("unexpected clip %+v", clip)
+	}
+}
+
+func TestClipboardNegotiationParameters(t *testing.T) {
+	s, _ := newTestServer(t)
+	// As stored by clipshare set -f notes.txt.
+	s.SetEntry(DefaultChannel, Entry{Data: []byte("notes"), Filename: "notes.txt", MIMEType: "text/plain; charset=utf-8"})
+
+	for _, accept := range []string{"text/plain", "TEXT/Plain", "text/plain; charset=utf-8", "text/*", "*/*"} {
+		w := getClipboard(t, s, http.MethodGet, accept)
+		if w.Code != http.StatusOK || w.Body.String() != "notes" || w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+			t.Errorf("Accept %q: expected the file, got %d: %q as %s", accept, w.Code, w.Body, w.Header().Get("Content-Type"))
+		}
+	}
+	if w := getClipboard(t, s, http.MethodGet, "text/plain;q=0, application/json"); w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the JSON envelope, got %s", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestClipboardActiveContent(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	for _, e := range []Entry{
+		{Data: []byte("<script>alert(1)</script>"), MIMEType: "text/html"},
+		{Data: []byte("alert(1)"), MIMEType: "application/javascript; charset=utf-8"},
+		{Data: []byte("<svg onload=alert(1)/>"), Filename: "a.svg", MIMEType: "image/svg+xml"},
+	} {
+		s.SetEntry(DefaultChannel, e)
+
+		for _, accept := range []string{"", browserAccept} {
+			w := getClipboard(t, s, http.MethodGet, accept)
+			h := w.Header()
+			if w.Code != http.StatusOK || h.Get("Content-Type") != "application/octet-stream" {
+				t.Errorf("%s (Accept %q): expected opaque bytes, got %d as %s", e.MIMEType, accept, w.Code, h.Get("Content-Type"))
+			}
+			if cd := h.Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") {
+				t.Errorf("%s (Accept %q): expected an attachment, got %q", e.MIMEType, accept, cd)
+			}
+			if h.Get("X-Content-Type-Options") != "nosniff" {
+				t.Errorf("%s (Accept %q): expected nosniff", e.MIMEType, accept)
+			}
+		}
+		if w := getClipboard(t, s, http.MethodGet, e.MIMEType); w.Code != http.StatusNotAcceptable {
+			t.Errorf("%s: expected status %d when asked for its own type, got %d", e.MIMEType, http.StatusNotAcceptable, w.Code)
+		}
+	}
+
+	// Other files are downloaded too, but keep their type.
+	s.SetEntry(DefaultChannel, Entry{Data: []byte("{}"), MIMEType: "application/json"})
+	w := getClipboard(t, s, http.MethodGet, "")
+	if w.Header().Get("Content-Type") != "application/json" || w.Header().Get("Content-Disposition") != "attachment" {
+		t.Errorf("expected a JSON attachment, got %v", w.Header())
+	}
+	s.SetEntry(DefaultChannel, Entry{Data: []byte("\x89PNG"), MIMEType: "image/png"})
+	if cd := getClipboard(t, s, http.MethodGet, "").Header().Get("Content-Disposition"); cd != "" {
+		t.Errorf("expected images to be shown inline, got %q", cd)
+	}
+}
+
+func TestClipboardHead(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	w := getClipboard(t, s, http.MethodHead, "")
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("expected an empty 200, got %d with %q", w.Code, w.Body)
+	}
+	if w.Header().Get("Content-Length") != "0" || w.Header().Get(DeviceHeader) != "" || w.Header().Get(ExpiresHeader) != "" {
+		t.Errorf("unexpected headers for an empty channel: %v", w.Header())
+	}
+
+	s.SetEntry(DefaultChannel, Entry{Data: []byte("%PDF"), Filename: "a.pdf", MIMEType: "application/pdf", Device: "laptop"})
+	w = getClipboard(t, s, http.MethodHead, "")
+	want := map[string]string{
+		"Content-Length":      "4",
+		"Content-Type":        "application/pdf",
+		"Content-Disposition": `attachment; filename=a.pdf`,
+		DeviceHeader:          "laptop",
+		ExpiresHeader:         "2025-01-01T00:01:00Z",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("expected %s %q, got %q", k, v, got)
+		}
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("expected no body, got %q", w.Body)
+	}
+
+	w = getClipboard(t, s, http.MethodHead, "application/json")
+	if w.Header().Get("Content-Type") != "application/json" || w.Header().Get("Content-Length") == "4" {
+		t.Errorf("expected the headers of the JSON envelope, got %v", w.Header())
+	}
+}
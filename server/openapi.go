@@ -0,0 +1,191 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:generate go test -run TestSpecJSON -update
+
+//go:embed openapi.yaml
+var openapiYAML []byte
+
+//go:embed docs.html
+var docsHTML string
+
+var docsTemplate = template.Must(template.New("docs").Parse(docsHTML))
+
+// openapiJSON is openapi.yaml converted to JSON by go generate, so that the
+// server doesn't need a YAML parser. As in the YAML parser of the tests,
+// every scalar is a string.
+//
+//go:embed openapi.json
+var openapiJSON []byte
+
+// loadSpec parses the spec the docs page is rendered from, on first use.
+var loadSpec = sync.OnceValues(func() (map[string]any, error) {
+	var spec map[string]any
+	if err := json.Unmarshal(openapiJSON, &spec); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	return spec, nil
+})
+
+// specMethods are the operations of a path item, in the order they are
+// documented.
+var specMethods = []string{"get", "head", "post", "put", "patch", "delete", "options"}
+
+type docsPage struct {
+	Title       string
+	Version     string
+	Description string
+	Operations  []docsOperation
+}
+
+type docsOperation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Parameters  []docsParameter
+	// RequestTypes are the media types of the request body.
+	RequestTypes []string
+	Responses    []docsResponse
+}
+
+type docsParameter struct {
+	Name        string
+	In          string
+	Required    bool
+	Description string
+}
+
+type docsResponse struct {
+	Status      string
+	Description string
+	Types       []string
+}
+
+// specMap returns v as a mapping, resolving references.
+func specMap(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	if ref, ok := m["$ref"].(string); ok {
+		m, _ = specRef(ref).(map[string]any)
+	}
+	return m
+}
+
+// specRef resolves a local reference, such as
+// "#/components/parameters/channel", or returns nil.
+func specRef(ref string) any {
+	path, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil
+	}
+	spec, _ := loadSpec()
+	var v any = spec
+	for _, name := range strings.Split(path, "/") {
+		name = strings.NewReplacer("~1", "/", "~0", "~").Replace(name)
+		m, _ := v.(map[string]any)
+		v = m[name]
+	}
+	return v
+}
+
+// sortedKeys returns the keys of a mapping, sorted.
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// newDocsPage lists the operations of spec, sorted by path.
+func newDocsPage(spec map[string]any) docsPage {
+	info := specMap(spec["info"])
+	page := docsPage{}
+	page.Title, _ = info["title"].(string)
+	page.Version, _ = info["version"].(string)
+	page.Description, _ = info["description"].(string)
+
+	paths := specMap(spec["paths"])
+	for _, path := range sortedKeys(paths) {
+		item := specMap(paths[path])
+		for _, method := range specMethods {
+			op := specMap(item[method])
+			if op == nil {
+				continue
+			}
+
+			o := docsOperation{Method: strings.ToUpper(method), Path: path}
+			o.Summary, _ = op["summary"].(string)
+			o.Description, _ = op["description"].(string)
+
+			params, _ := item["parameters"].([]any)
+			opParams, _ := op["parameters"].([]any)
+			for _, p := range slices.Concat(params, opParams) {
+				p := specMap(p)
+				var dp docsParameter
+				dp.Name, _ = p["name"].(string)
+				dp.In, _ = p["in"].(string)
+				dp.Description, _ = p["description"].(string)
+				dp.Required = p["required"] == "true"
+				o.Parameters = append(o.Parameters, dp)
+			}
+
+			o.RequestTypes = sortedKeys(specMap(specMap(op["requestBody"])["content"]))
+
+			responses := specMap(op["responses"])
+			for _, status := range sortedKeys(responses) {
+				r := specMap(responses[status])
+				dr := docsResponse{Status: status, Types: sortedKeys(specMap(r["content"]))}
+				dr.Description, _ = r["description"].(string)
+				o.Responses = append(o.Responses, dr)
+			}
+
+			page.Operations = append(page.Operations, o)
+		}
+	}
+	return page
+}
+
+// specHandler serves the OpenAPI spec of the API.
+func (s *Server) specHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openapiYAML)
+}
+
+// docsHandler serves a page describing the API, rendered from its spec.
+func (s *Server) docsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	spec, err := loadSpec()
+	if err != nil {
+		log.Printf("clipshare: %v", err)
+		http.Error(w, "Failed to load the API spec", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := docsTemplate.Execute(w, newDocsPage(spec)); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// DefaultMaxPinDuration bounds how long pinned content is kept when
+// Options.MaxPinDuration is not set.
+const DefaultMaxPinDuration = 8 * time.Hour
+
+var (
+	// ErrEmptyChannel is returned when pinning or unpinning an empty
+	// channel.
+	ErrEmptyChannel = errors.New("channel is empty")
+
+	// ErrSensitivePin is returned when pinning content that looks like a
+	// secret, which is meant to be cleared soon.
+	ErrSensitivePin = errors.New("content that looks like a secret can't be pinned")
+)
+
+// Pin keeps the content of a channel for d instead of the TTL, until it is
+// replaced or unpinned. Pins last at most the maximum pin duration, which is
+// also used when d is not positive, counted from the first time the content
+// was pinned: pinning it again can't keep it longer. It returns when the
+// content will be cleared.
+func (s *Server) Pin(channel string, d time.Duration) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.channels[channel]
+	if !ok {
+		return time.Time{}, ErrEmptyChannel
+	}
+	if c.Sensitive {
+		return time.Time{}, ErrSensitivePin
+	}
+
+	if d <= 0 || d > s.maxPin {
+		d = s.maxPin
+	}
+	until := s.clock.Now().Add(d)
+	if limit := c.pinnedAt.Add(s.maxPin); !c.pinnedAt.IsZero() && until.After(limit) {
+		until = limit
+	}
+	// Pins never make content expire sooner.
+	if until.Before(c.expiresAt) {
+		until = c.expiresAt
+	}
+	s.pinLocked(channel, c, until)
+	s.replicate(replication{Type: api.EventPin, Channel: channel, version: s.versions[channel], PinnedUntil: c.expiresAt})
+	return c.expiresAt, nil
+}
+
+// Unpin lets the content of a channel expire after the TTL again, counted
+// from now. It returns when the content will be cleared.
+func (s *Server) Unpin(channel string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.channels[channel]
+	if !ok {
+		return time.Time{}, ErrEmptyChannel
+	}
+	if c.pinned {
+		s.unpinLocked(channel, c)
+		s.replicate(replication{Type: api.EventUnpin, Channel: channel, version: s.versions[channel]})
+	}
+	return c.expiresAt, nil
+}
+
+// pinLocked must be called with s.mu held.
+func (s *Server) pinLocked(channel string, c *clipboard, until time.Time) {
+	if c.pinnedAt.IsZero() {
+		c.pinnedAt = s.clock.Now()
+	}
+	c.pinned = true
+	s.expireAtLocked(channel, c, until)
+	s.publish(c.event(api.EventPin, channel))
+}
+
+// unpinLocked must be called with s.mu held.
+func (s *Server) unpinLocked(channel string, c *clipboard) {
+	c.pinned = false
+	s.expireAtLocked(channel, c, s.clock.Now().Add(s.ttl))
+	s.publish(c.event(api.EventUnpin, channel))
+}
+
+// pinHandler pins the content of a channel with POST, for the duration in
+// the "duration" query parameter or the longest allowed, and unpins it with
+// DELETE.
+func (s *Server) pinHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.pin(w, r); ok {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// v1PinHandler is /clipboard/pin, answering with the content of the
+// channel.
+func (s *Server) v1PinHandler(w http.ResponseWriter, r *http.Request) {
+	if channel, ok := s.pin(w, r); ok {
+		writeData(w, s.clip(channel))
+	}
+}
+
+// pin pins or unpins the channel of r. On failure, it answers r and reports
+// false.
+func (s *Server) pin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	channel, ok := channelFromRequest(r)
+	if !ok {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return "", false
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		var d time.Duration
+		if value := r.URL.Query().Get("duration"); value != "" {
+			if d, err = time.ParseDuration(value); err != nil || d <= 0 {
+				http.Error(w, "Invalid duration", http.StatusBadRequest)
+				return "", false
+			}
+		}
+		_, err = s.Pin(channel, d)
+
+	case http.MethodDelete:
+		_, err = s.Unpin(channel)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+
+	switch {
+	case errors.Is(err, ErrEmptyChannel):
+		http.Error(w, "Channel is empty", http.StatusNotFound)
+		return "", false
+	case errors.Is(err, ErrSensitivePin):
+		http.Error(w, "Secrets can't be pinned", http.StatusConflict)
+		return "", false
+	}
+	return channel, true
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+func TestPin(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.Set(DefaultChannel, "meeting link", "laptop")
+
+	until, err := s.Pin(DefaultChannel, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.Now().Add(2 * time.Hour); !until.Equal(want) {
+		t.Errorf("expected to be pinned until %v, got %v", want, until)
+	}
+
+	clock.Advance(time.Hour)
+	if s.Content(DefaultChannel) != "meeting link" {
+		t.Fatal("pinned content cleared after the TTL")
+	}
+	w := getClipboard(t, s, http.MethodHead, "")
+	if w.Header().Get(PinnedHeader) != "true" || w.Header().Get(ExpiresHeader) != "2025-01-01T02:00:00Z" {
+		t.Errorf("expected pinned metadata, got %v", w.Header())
+	}
+
+	clock.Advance(time.Hour)
+	if got := s.Content(DefaultChannel); got != "" {
+		t.Errorf("expected the pin to run out, got %q", got)
+	}
+}
+
+func TestPinMaxDuration(t *testing.T) {
+	clock := newFakeClock()
+	s := New(Options{TTL: time.Minute, MaxPinDuration: 4 * time.Hour, Clock: clock})
+	s.Set(DefaultChannel, "hello", "laptop")
+
+	for _, d := range []time.Duration{0, 24 * time.Hour} {
+		until, err := s.Pin(DefaultChannel, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := clock.Now().Add(4 * time.Hour); !until.Equal(want) {
+			t.Errorf("pinning for %v: expected to be pinned until %v, got %v", d, want, until)
+		}
+	}
+}
+
+func TestRepin(t *testing.T) {
+	clock := newFakeClock()
+	s := New(Options{TTL: time.Minute, MaxPinDuration: 4 * time.Hour, Clock: clock})
+	s.Set(DefaultChannel, "hello", "laptop")
+	limit := clock.Now().Add(4 * time.Hour)
+	s.Pin(DefaultChannel, time.Hour)
+
+	// Renewed pins, even after an unpin, count from the first one.
+	clock.Advance(50 * time.Minute)
+	s.Pin(DefaultChannel, 0)
+	clock.Advance(3 * time.Hour)
+	s.Unpin(DefaultChannel)
+	for _, d := range []time.Duration{time.Hour, 0} {
+		until, err := s.Pin(DefaultChannel, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !until.Equal(limit) {
+			t.Errorf("pinning for %v: expected to be pinned until %v, got %v", d, limit, until)
+		}
+	}
+
+	clock.Advance(limit.Sub(clock.Now()))
+	if got := s.Content(DefaultChannel); got != "" {
+		t.Errorf("expected the content to be cleared at the limit, got %q", got)
+	}
+
+	// New content can be pinned for the whole duration again.
+	s.Set(DefaultChannel, "bye", "laptop")
+	if until, _ := s.Pin(DefaultChannel, 0); !until.Equal(clock.Now().Add(4 * time.Hour)) {
+		t.Errorf("expected new content to be pinned for 4h, got until %v", until)
+	}
+}
+
+func TestUnpin(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.Set(DefaultChannel, "hello", "laptop")
+	s.Pin(DefaultChannel, time.Hour)
+	clock.Advance(30 * time.Minute)
+
+	// The TTL starts over.
+	until, err := s.Unpin(DefaultChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.Now().Add(time.Minute); !until.Equal(want) {
+		t.Errorf("expected to expire at %v, got %v", want, until)
+	}
+	if clip := s.clip(DefaultChannel); clip.Pinned {
+		t.Error("expected the content not to be pinned")
+	}
+
+	clock.Advance(time.Minute)
+	if got := s.Content(DefaultChannel); got != "" {
+		t.Errorf("expected the content to expire after the TTL, got %q", got)
+	}
+}
+
+func TestPinReplacedContent(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.Set(DefaultChannel, "hello", "laptop")
+	s.Pin(DefaultChannel, time.Hour)
+
+	// Pins belong to the content they were made for.
+	s.Set(DefaultChannel, "bye", "laptop")
+	if clip := s.clip(DefaultChannel); clip.Pinned {
+		t.Error("expected new content not to be pinned")
+	}
+	clock.Advance(time.Minute)
+	if got := s.Content(DefaultChannel); got != "" {
+		t.Errorf("expected new content to expire after the TTL, got %q", got)
+	}
+}
+
+func TestPinErrors(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	if _, err := s.Pin(DefaultChannel, time.Hour); !errors.Is(err, ErrEmptyChannel) {
+		t.Errorf("expected ErrEmptyChannel, got %v", err)
+	}
+	if _, err := s.Unpin(DefaultChannel); !errors.Is(err, ErrEmptyChannel) {
+		t.Errorf("expected ErrEmptyChannel, got %v", err)
+	}
+
+	s.Set(DefaultChannel, "token: "+testGitHubToken, "laptop")
+	if _, err := s.Pin(DefaultChannel, time.Hour); !errors.Is(err, ErrSensitivePin) {
+		t.Errorf("expected ErrSensitivePin, got %v", err)
+	}
+}
+
+func TestPinEvents(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Set(DefaultChannel, "hello", "laptop")
+
+	events, unsubscribe := s.Subscribe(DefaultChannel)
+	defer unsubscribe()
+	<-events
+
+	s.Pin(DefaultChannel, time.Hour)
+	if ev := <-events; ev.Type != api.EventPin || !ev.Pinned || ev.Text != "hello" {
+		t.Errorf("expected a pin event with the content, got %+v", ev)
+	}
+	s.Unpin(DefaultChannel)
+	if ev := <-events; ev.Type != api.EventUnpin || ev.Pinned || ev.Text != "hello" {
+		t.Errorf("expected an unpin event with the content, got %+v", ev)
+	}
+}
+
+func TestReplicationPin(t *testing.T) {
+	servers, clocks, _ := newCluster(t, 3)
+
+	servers[0].Set(DefaultChannel, "hello", "test")
+	waitForContent(t, servers[2], "hello")
+
+	until, _ := servers[0].Pin(DefaultChannel, time.Hour)
+	waitFor(t, func() bool { return servers[2].clip(DefaultChannel).Pinned })
+	if clip := servers[2].clip(DefaultChannel); !clip.ExpiresAt.Equal(until) {
+		t.Errorf("expected the peer to keep the content until %v, got %v", until, clip.ExpiresAt)
+	}
+	clocks[2].Advance(time.Minute)
+	if servers[2].Content(DefaultChannel) != "hello" {
+		t.Error("expected the peer to keep pinned content past the TTL")
+	}
+
+	servers[1].Unpin(DefaultChannel)
+	waitFor(t, func() bool { return !servers[0].clip(DefaultChannel).Pinned && !servers[2].clip(DefaultChannel).Pinned })
+}
+
+// waitFor waits until cond holds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// static holds the assets making the web UI an installable app: the
+// manifest, its icons and the service worker.
+//
+//go:embed static
+var static embed.FS
+
+// shareDevice is the device recorded for content shared from other apps.
+const shareDevice = "share"
+
+// staticHandler serves the embedded assets from the root, without
+// directory listings.
+func staticHandler() http.Handler {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	files := http.FileServerFS(sub)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		// Not every system's MIME table knows about manifests.
+		if path.Ext(r.URL.Path) == ".webmanifest" {
+			w.Header().Set("Content-Type", "application/manifest+json")
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// shareHandler receives the content shared with the installed app, see the
+// share_target of the manifest. A shared file takes precedence over text.
+func (s *Server) shareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	channel, ok := channelFromRequest(r)
+	if !ok {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	err := r.ParseMultipartForm(maxBodySize)
+	if errors.Is(err, http.ErrNotMultipart) {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+
+	req := api.SetRequest{
+		Text:   sharedText(r.PostFormValue("title"), r.PostFormValue("text"), r.PostFormValue("url")),
+		Device: shareDevice,
+	}
+	// The clipboard holds a single entry: keep the first file.
+	if fh := formFile(r.MultipartForm, "files"); fh != nil {
+		if err := readFormFile(fh, &req); err != nil {
+			http.Error(w, "Error reading shared file", http.StatusBadRequest)
+			return
+		}
+	} else if req.Text == "" {
+		http.Error(w, "Nothing to share", http.StatusBadRequest)
+		return
+	}
+
+	s.SetEntry(channel, entryFromRequest(r, req))
+
+	target := "/"
+	if name := channelName(channel); name != DefaultChannel {
+		target += "?" + url.Values{"channel": {name}}.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// sharedText joins the fields of a share. Apps often repeat the URL in the
+// text, and send a title only when there's nothing else.
+func sharedText(title, text, link string) string {
+	var parts []string
+	if text != "" {
+		parts = append(parts, text)
+	}
+	if link != "" && !strings.Contains(text, link) {
+		parts = append(parts, link)
+	}
+	if len(parts) == 0 && title != "" {
+		parts = append(parts, title)
+	}
+	return strings.Join(parts, "\n")
+}
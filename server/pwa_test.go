@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestStaticAssets(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+	}{
+		{"/manifest.webmanifest", http.StatusOK, "application/manifest+json"},
+		{"/sw.js", http.StatusOK, "text/javascript; charset=utf-8"},
+		{"/crypto.js", http.StatusOK, "text/javascript; charset=utf-8"},
+		{"/icons/icon.svg", http.StatusOK, "image/svg+xml"},
+		{"/icons/icon-192.png", http.StatusOK, "image/png"},
+		{"/icons/icon-512.png", http.StatusOK, "image/png"},
+		{"/icons/", http.StatusNotFound, ""},
+		{"/icons/missing.png", http.StatusNotFound, ""},
+		{"/static/sw.js", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.status, w.Code)
+		}
+		if tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("%s: expected Content-Type %s, got %s", tt.path, tt.contentType, w.Header().Get("Content-Type"))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/sw.js", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	data, err := static.ReadFile("static/manifest.webmanifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest struct {
+		StartURL string `json:"start_url"`
+		Icons    []struct {
+			Src string `json:"src"`
+		} `json:"icons"`
+		ShareTarget struct {
+			Action  string `json:"action"`
+			Method  string `json:"method"`
+			Enctype string `json:"enctype"`
+			Params  struct {
+				Files []struct {
+					Name string `json:"name"`
+				} `json:"files"`
+			} `json:"params"`
+		} `json:"share_target"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+
+	s, _ := newTestServer(t)
+	for _, icon := range manifest.Icons {
+		req := httptest.NewRequest(http.MethodGet, icon.Src, nil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("icon %s: expected status %d, got %d", icon.Src, http.StatusOK, w.Code)
+		}
+	}
+
+	st := manifest.ShareTarget
+	if st.Action != "/share" || st.Method != "POST" || st.Enctype != "multipart/form-data" {
+		t.Errorf("unexpected share target %+v", st)
+	}
+	if len(st.Params.Files) != 1 || st.Params.Files[0].Name != "files" {
+		t.Errorf("unexpected shared files %+v", st.Params.Files)
+	}
+}
+
+func TestShare(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	req := multipartForm(t, "/share", map[string]string{"title": "Example", "text": "Look at this", "url": "https://example.com"}, "files", "", "", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected status %d, got %d", http.StatusSeeOther, w.Code)
+	}
+	if loc := w.Header().Get("Location"); loc != "/" {
+		t.Errorf("expected redirect to /, got %s", loc)
+	}
+	e, _ := s.Get(DefaultChannel)
+	if string(e.Data) != "Look at this\nhttps://example.com" || e.Device != shareDevice || !e.IsText() {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	req = multipartForm(t, "/share?channel=work", map[string]string{"text": "x"}, "files", "../shot.png", "image/png", []byte("\x89PNG"))
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if loc := w.Header().Get("Location"); loc != "/?channel=work" {
+		t.Errorf("expected redirect to /?channel=work, got %s", loc)
+	}
+	e, _ = s.Get("work")
+	if string(e.Data) != "\x89PNG" || e.Filename != "shot.png" || e.MIMEType != "image/png" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	form := url.Values{"url": {"https://example.org"}}
+	req = httptest.NewRequest(http.MethodPost, "/share", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusSeeOther || s.Content(DefaultChannel) != "https://example.org" {
+		t.Errorf("unexpected status %d and content %q", w.Code, s.Content(DefaultChannel))
+	}
+
+	req = multipartForm(t, "/share", map[string]string{"text": ""}, "files", "", "", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for an empty share, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/share", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestSharedText(t *testing.T) {
+	tests := []struct {
+		title, text, link string
+		want              string
+	}{
+		{"", "hello", "", "hello"},
+		{"", "", "https://example.com", "https://example.com"},
+		{"", "read https://example.com", "https://example.com", "read https://example.com"},
+		{"Title", "text", "https://example.com", "text\nhttps://example.com"},
+		{"Title", "", "", "Title"},
+		{"", "", "", ""},
+	}
+	for _, tt := range tests {
+		if got := sharedText(tt.title, tt.text, tt.link); got != tt.want {
+			t.Errorf("sharedText(%q, %q, %q) = %q, want %q", tt.title, tt.text, tt.link, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"net/http"
+	"net/url"
+
+	"github.com/aldur/clipshare/qr"
+)
+
+// qrScale is the size of a QR code module, in pixels.
+const qrScale = 8
+
+func (s *Server) clipboardQRHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	channel, ok := channelFromRequest(r)
+	if !ok {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return
+	}
+
+	e, ok := s.Get(channel)
+	if !ok {
+		http.Error(w, "Clipboard is empty", http.StatusNotFound)
+		return
+	}
+	if !e.IsText() {
+		http.Error(w, "Only text content can be encoded", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	writeQR(w, e.Data)
+}
+
+// serverQRHandler encodes the URL of the web UI, as reached by the client,
+// so that other devices can open it.
+func (s *Server) serverQRHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	channel, ok := channelFromRequest(r)
+	if !ok {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return
+	}
+
+	writeQR(w, []byte(serverURL(r, channelName(channel))))
+}
+
+// serverURL returns the URL of the web UI for channel, based on the request.
+func serverURL(r *http.Request, channel string) string {
+	u := url.URL{Scheme: "http", Host: r.Host, Path: "/"}
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		u.Scheme = proto
+	}
+	if channel != DefaultChannel {
+		u.RawQuery = url.Values{"channel": {channel}}.Encode()
+	}
+	return u.String()
+}
+
+func writeQR(w http.ResponseWriter, data []byte) {
+	code, err := qr.Encode(data, qr.M)
+	if errors.Is(err, qr.ErrTooLong) {
+		http.Error(w, "Content too long for a QR code", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error encoding QR code", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, code.Image(qrScale)); err != nil {
+		http.Error(w, "Error encoding QR code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aldur/clipshare/api"
+	"github.com/aldur/clipshare/qr"
+)
+
+// expectQR checks that w holds the PNG QR code of data.
+func expectQR(t *testing.T, w *httptest.ResponseRecorder, data string) {
+	t.Helper()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expected Content-Type image/png, got %s", ct)
+	}
+
+	got, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("invalid PNG: %v", err)
+	}
+	code, err := qr.Encode([]byte(data), qr.M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := code.Image(qrScale)
+
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("expected bounds %v, got %v", want.Bounds(), got.Bounds())
+	}
+	for y := range want.Bounds().Dy() {
+		for x := range want.Bounds().Dx() {
+			if !sameColor(got, want, x, y) {
+				t.Fatalf("QR code of %q differs at (%d, %d)", data, x, y)
+			}
+		}
+	}
+}
+
+func sameColor(a, b image.Image, x, y int) bool {
+	ar, ag, ab, aa := a.At(x, y).RGBA()
+	br, bg, bb, ba := b.At(x, y).RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
+
+func TestClipboardQR(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/clipboard/qr", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for empty clipboard, got %d", http.StatusNotFound, w.Code)
+	}
+
+	s.Set("work", "https://example.com", "test")
+	req = httptest.NewRequest(http.MethodGet, "/clipboard/qr?channel=work", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	expectQR(t, w, "https://example.com")
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("expected Cache-Control no-store, got %s", cc)
+	}
+
+	s.Set(DefaultChannel, strings.Repeat("a", 3000), "test")
+	req = httptest.NewRequest(http.MethodGet, "/clipboard/qr", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d for long content, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	postJSON(t, s, api.SetRequest{Data: []byte{0x89, 'P', 'N', 'G'}, Filename: "image.png"})
+	req = httptest.NewRequest(http.MethodGet, "/clipboard/qr", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status %d for a file, got %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/clipboard/qr", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestServerQR(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		target string
+		proto  string
+		want   string
+	}{
+		{"/qr/server", "", "http://clipshare.example:8080/"},
+		{"/qr/server?channel=default", "", "http://clipshare.example:8080/"},
+		{"/qr/server?channel=work", "", "http://clipshare.example:8080/?channel=work"},
+		{"/qr/server", "https", "https://clipshare.example:8080/"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.Host = "clipshare.example:8080"
+		if tt.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		expectQR(t, w, tt.want)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/qr/server?channel=../x", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestIndexQR(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/?channel=work", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if !bytes.Contains(w.Body.Bytes(), []byte(`src="/qr/server?channel=work"`)) {
+		t.Errorf("expected server QR code in index, got %s", w.Body.String())
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`<figure id="contentQR" hidden>`)) {
+		t.Errorf("expected the content QR code to be hidden for an empty clipboard")
+	}
+
+	s.Set("work", "hello", "test")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if !bytes.Contains(w.Body.Bytes(), []byte(`<figure id="contentQR">`)) {
+		t.Errorf("expected content QR code in index, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+const (
+	// peerQueueSize is how many changes may wait to be pushed to a peer
+	// before further changes are dropped for it.
+	peerQueueSize = 256
+
+	// peerTimeout bounds a single push to a peer.
+	peerTimeout = 10 * time.Second
+
+	// peerAttempts is how many times a change is pushed before giving up.
+	peerAttempts = 5
+
+	// maxPeerBackoff bounds the delay between attempts.
+	maxPeerBackoff = time.Minute
+)
+
+// peerBackoff is the delay before the first retry of a push. It doubles on
+// every attempt, up to maxPeerBackoff.
+var peerBackoff = time.Second
+
+// version orders the changes of a channel across servers: the later
+// timestamp wins, and the origin breaks ties.
+type version struct {
+	// Timestamp is in Unix nanoseconds.
+	Timestamp int64  `json:"timestamp"`
+	Origin    string `json:"origin"`
+}
+
+func (v version) after(o version) bool {
+	if v.Timestamp != o.Timestamp {
+		return v.Timestamp > o.Timestamp
+	}
+	return v.Origin > o.Origin
+}
+
+// replication is a change pushed to peers. Expiries, pins and unpins carry
+// the version of the content they apply to, so that they can't affect newer
+// content.
+type replication struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	version
+
+	Data     []byte `json:"data,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Device   string `json:"device,omitempty"`
+
+	Sensitive bool     `json:"sensitive,omitempty"`
+	User      api.User `json:"user,omitzero"`
+
+	// PinnedUntil is when pinned content will be cleared.
+	PinnedUntil time.Time `json:"pinned_until,omitzero"`
+}
+
+func (r replication) entry() Entry {
+	return Entry{Data: r.Data, Filename: r.Filename, MIMEType: r.MIMEType, Device: r.Device, Sensitive: r.Sensitive, User: r.User}
+}
+
+// peer is a server that changes are pushed to, in order, by a background
+// worker.
+type peer struct {
+	url   string
+	queue chan replication
+}
+
+// defaultOrigin names the server after its host, falling back to a random
+// name.
+func defaultOrigin() string {
+	if name, err := os.Hostname(); err == nil && name != "" {
+		return name
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startPeers starts a worker for each peer URL.
+func (s *Server) startPeers(urls []string) {
+	client := &http.Client{Timeout: peerTimeout}
+	backoff := peerBackoff
+	for _, url := range urls {
+		p := &peer{url: strings.TrimSuffix(url, "/"), queue: make(chan replication, peerQueueSize)}
+		s.peers = append(s.peers, p)
+
+		s.peersDone.Add(1)
+		go func() {
+			defer s.peersDone.Done()
+			for r := range p.queue {
+				if err := s.replicateTo(client, p, r, backoff); err != nil {
+					log.Printf("clipshare: failed to replicate %s of channel %q to %s: %v", r.Type, r.Channel, p.url, err)
+				}
+			}
+		}()
+	}
+}
+
+// Close stops replication and webhooks after pushing the changes already
+// queued for peers, and sending the events queued for webhook targets once.
+// It is a no-op for servers without peers or webhooks.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+		for _, p := range s.peers {
+			close(p.queue)
+		}
+		for _, h := range s.webhooks {
+			close(h.queue)
+		}
+	}
+	s.mu.Unlock()
+
+	s.peersDone.Wait()
+	s.webhooksDone.Wait()
+}
+
+// nextVersion returns the version of a local change of channel, which must
+// win over any change already applied to it even if a peer clock is ahead.
+// It must be called with s.mu held.
+func (s *Server) nextVersion(channel string) version {
+	ts := s.clock.Now().UnixNano()
+	if v, ok := s.versions[channel]; ok && v.Timestamp >= ts {
+		ts = v.Timestamp + 1
+	}
+	return version{Timestamp: ts, Origin: s.origin}
+}
+
+// replicate queues r for every peer. It must be called with s.mu held, so
+// that peers receive changes in the order they were applied.
+func (s *Server) replicate(r replication) {
+	if s.closed {
+		return
+	}
+	for _, p := range s.peers {
+		select {
+		case p.queue <- r:
+		default:
+			log.Printf("clipshare: dropping %s of channel %q for %s: queue full", r.Type, r.Channel, p.url)
+		}
+	}
+}
+
+// replicateTo pushes r to p, retrying with exponential backoff on network
+// errors and on server errors, as webhooks are delivered. Later changes wait
+// meanwhile, so that p still applies them in order. Once the server is
+// closed, changes are only tried once.
+func (s *Server) replicateTo(client *http.Client, p *peer, r replication, backoff time.Duration) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := s.push(client, p, body)
+		if err == nil || !retry || attempt == peerAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-s.done:
+			return err
+		}
+		backoff = min(2*backoff, maxPeerBackoff)
+	}
+}
+
+// push sends a change to p, reporting whether a failure may go away by
+// retrying.
+func (s *Server) push(client *http.Client, p *peer, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), peerTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url+"/replicate", bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.peerToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+		return retry, fmt.Errorf("peer returned %s", resp.Status)
+	}
+	return false, nil
+}
+
+// apply applies a change received from a peer unless the channel already
+// has a newer one, and forwards it to the other peers. Changes that come
+// back, including our own, are never newer, which stops them from looping.
+func (s *Server) apply(r replication) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, known := s.versions[r.Channel]
+
+	switch r.Type {
+	case api.EventSet, api.EventClear:
+		if known && !r.version.after(current) {
+			return
+		}
+		if r.Type == api.EventSet {
+			s.setLocked(r.Channel, r.entry(), r.version)
+		} else {
+			s.clearLocked(r.Channel, r.version)
+		}
+
+	case api.EventExpire:
+		if _, ok := s.channels[r.Channel]; !ok || current != r.version {
+			return
+		}
+		s.expireLocked(r.Channel)
+
+	case api.EventPin, api.EventUnpin:
+		c, ok := s.channels[r.Channel]
+		if !ok || current != r.version {
+			return
+		}
+		// Pins that come back are already applied, which stops them from
+		// looping.
+		if r.Type == api.EventPin {
+			if c.pinned && c.expiresAt.Equal(r.PinnedUntil) {
+				return
+			}
+			s.pinLocked(r.Channel, c, r.PinnedUntil)
+		} else {
+			if !c.pinned {
+				return
+			}
+			s.unpinLocked(r.Channel, c)
+		}
+	}
+
+	s.replicate(r)
+}
+
+func (s *Server) replicationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.peerToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	var rep replication
+	if err := json.Unmarshal(body, &rep); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !validChannelKey(rep.Channel) {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return
+	}
+	switch rep.Type {
+	case api.EventSet, api.EventClear, api.EventExpire, api.EventPin, api.EventUnpin:
+	default:
+		http.Error(w, "Invalid change type", http.StatusBadRequest)
+		return
+	}
+
+	s.apply(rep)
+
+	w.WriteHeader(http.StatusOK)
+}
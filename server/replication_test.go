@@ -0,0 +1,259 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+const testPeerToken = "peer-secret"
+
+// newCluster starts n servers replicating to each other, each with its own
+// clock. It returns how many replication requests each server received.
+func newCluster(t *testing.T, n int) ([]*Server, []*fakeClock, []*atomic.Int64) {
+	t.Helper()
+
+	servers := make([]*Server, n)
+	clocks := make([]*fakeClock, n)
+	received := make([]*atomic.Int64, n)
+	urls := make([]string, n)
+
+	for i := range n {
+		received[i] = &atomic.Int64{}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/replicate" {
+				received[i].Add(1)
+			}
+			servers[i].ServeHTTP(w, r)
+		}))
+		t.Cleanup(ts.Close)
+		urls[i] = ts.URL
+	}
+
+	for i := range n {
+		var peers []string
+		for j, url := range urls {
+			if j != i {
+				peers = append(peers, url)
+			}
+		}
+
+		clocks[i] = newFakeClock()
+		servers[i] = New(Options{
+			TTL:       time.Minute,
+			Clock:     clocks[i],
+			Origin:    fmt.Sprintf("node%d", i),
+			Peers:     peers,
+			PeerToken: testPeerToken,
+		})
+		// Registered after the HTTP servers, so it runs before they close.
+		t.Cleanup(servers[i].Close)
+	}
+
+	return servers, clocks, received
+}
+
+// waitForContent waits until the default channel of s holds want.
+func waitForContent(t *testing.T, s *Server, want string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Content(DefaultChannel) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected content %q, got %q", want, s.Content(DefaultChannel))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func postReplication(t *testing.T, s *Server, token string, r replication) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, _ := json.Marshal(r)
+	req := httptest.NewRequest(http.MethodPost, "/replicate", bytes.NewBuffer(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestReplicationSetAndClear(t *testing.T) {
+	servers, _, _ := newCluster(t, 3)
+
+	servers[0].SetEntry(DefaultChannel, Entry{Data: []byte{0, 1}, Filename: "a.bin", MIMEType: "application/octet-stream", Device: "laptop"})
+	for _, s := range servers[1:] {
+		waitForContent(t, s, "\x00\x01")
+		if e, _ := s.Get(DefaultChannel); e.Filename != "a.bin" || e.Device != "laptop" {
+			t.Errorf("expected the whole entry to be replicated, got %+v", e)
+		}
+	}
+
+	servers[1].Clear(DefaultChannel)
+	waitForContent(t, servers[0], "")
+	waitForContent(t, servers[2], "")
+}
+
+func TestReplicationRetry(t *testing.T) {
+	backoff := peerBackoff
+	peerBackoff = time.Millisecond
+	t.Cleanup(func() { peerBackoff = backoff })
+
+	// The peer is unreachable for the first two pushes.
+	peer := New(Options{TTL: time.Minute, Clock: newFakeClock(), Origin: "peer", PeerToken: testPeerToken})
+	var attempts atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= 2 {
+			http.Error(w, "Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		peer.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	s := New(Options{TTL: time.Minute, Clock: newFakeClock(), Origin: "node", Peers: []string{ts.URL}, PeerToken: testPeerToken})
+	t.Cleanup(s.Close)
+
+	// Changes are pushed in order, so the first is applied by the time the
+	// second is.
+	s.Set("work", "bye", "laptop")
+	s.Set(DefaultChannel, "hello", "laptop")
+	waitForContent(t, peer, "hello")
+	if got := peer.Content("work"); got != "bye" {
+		t.Errorf("expected the failed push to be retried, got %q", got)
+	}
+	if n := attempts.Load(); n != 4 {
+		t.Errorf("expected 4 pushes, got %d", n)
+	}
+}
+
+func TestReplicationExpire(t *testing.T) {
+	servers, clocks, _ := newCluster(t, 2)
+
+	servers[0].Set(DefaultChannel, "hello", "test")
+	waitForContent(t, servers[1], "hello")
+
+	// Only the origin times out: the peer clears its copy when told.
+	clocks[0].Advance(time.Minute)
+	waitForContent(t, servers[1], "")
+}
+
+func TestReplicationLoopSuppressed(t *testing.T) {
+	servers, _, received := newCluster(t, 3)
+
+	servers[0].Set(DefaultChannel, "hello", "test")
+	waitForContent(t, servers[1], "hello")
+	waitForContent(t, servers[2], "hello")
+
+	// Closing drains the queues in turn: the origin pushes to both peers,
+	// which forward once to each other and back, and nothing else.
+	for _, s := range servers {
+		s.Close()
+	}
+
+	var total int64
+	for _, n := range received {
+		total += n.Load()
+	}
+	if total != 6 {
+		t.Errorf("expected 6 replication requests, got %d", total)
+	}
+}
+
+func TestReplicationConflicts(t *testing.T) {
+	s := New(Options{TTL: time.Minute, Clock: newFakeClock(), Origin: "local", PeerToken: testPeerToken})
+	defer s.Close()
+
+	set := func(text string, ts int64, origin string) {
+		t.Helper()
+		r := replication{Type: api.EventSet, Channel: DefaultChannel, version: version{ts, origin}, Data: []byte(text), MIMEType: TextMIMEType}
+		if w := postReplication(t, s, testPeerToken, r); w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+	change := func(typ string, ts int64, origin string) {
+		t.Helper()
+		r := replication{Type: typ, Channel: DefaultChannel, version: version{ts, origin}}
+		if w := postReplication(t, s, testPeerToken, r); w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+	expect := func(want string) {
+		t.Helper()
+		if got := s.Content(DefaultChannel); got != want {
+			t.Errorf("expected content %q, got %q", want, got)
+		}
+	}
+
+	set("first", 100, "b")
+	expect("first")
+
+	set("older", 50, "z")
+	expect("first")
+
+	set("tie, lower origin", 100, "a")
+	expect("first")
+
+	set("tie, higher origin", 100, "c")
+	expect("tie, higher origin")
+
+	change(api.EventExpire, 100, "b")
+	expect("tie, higher origin")
+
+	change(api.EventClear, 90, "x")
+	expect("tie, higher origin")
+
+	change(api.EventExpire, 100, "c")
+	expect("")
+
+	change(api.EventClear, 200, "x")
+	set("before the clear", 150, "y")
+	expect("")
+
+	// Local changes win even when a peer clock is ahead.
+	set("future", 1<<62, "y")
+	s.Set(DefaultChannel, "local", "test")
+	expect("local")
+	set("future", 1<<62, "y")
+	expect("local")
+}
+
+func TestReplicationAuth(t *testing.T) {
+	s := New(Options{Clock: newFakeClock(), PeerToken: testPeerToken})
+	defer s.Close()
+
+	r := replication{Type: api.EventSet, Channel: DefaultChannel, version: version{1, "peer"}, Data: []byte("x")}
+	for _, token := range []string{"", "wrong"} {
+		if w := postReplication(t, s, token, r); w.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: expected status %d, got %d", token, http.StatusUnauthorized, w.Code)
+		}
+	}
+	if s.Content(DefaultChannel) != "" {
+		t.Error("unauthenticated changes should not be applied")
+	}
+
+	bad := r
+	bad.Channel = "<b>"
+	if w := postReplication(t, s, testPeerToken, bad); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for an invalid channel, got %d", http.StatusBadRequest, w.Code)
+	}
+	bad = r
+	bad.Type = api.EventSnapshot
+	if w := postReplication(t, s, testPeerToken, bad); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for an invalid type, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Without a peer token the endpoint doesn't exist.
+	plain, _ := newTestServer(t)
+	if w := postReplication(t, plain, testPeerToken, r); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
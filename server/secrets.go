@@ -0,0 +1,95 @@
+package server
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aldur/clipshare/envelope"
+)
+
+// DefaultSensitiveTTL is how long content that looks like a secret is kept
+// when Options.SensitiveTTL is not set.
+const DefaultSensitiveTTL = 15 * time.Second
+
+// Kinds of secrets reported by detectSecret.
+const (
+	secretPrivateKey  = "private key"
+	secretAWSKey      = "AWS key"
+	secretGitHubToken = "GitHub token"
+	secretJWT         = "JWT"
+	secretHighEntropy = "high-entropy string"
+)
+
+// secretPatterns match well-known secret formats.
+var secretPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{secretPrivateKey, regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----`)},
+	{secretAWSKey, regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{secretAWSKey, regexp.MustCompile(`(?i)aws_secret_access_key\s*[=:]\s*["']?[A-Za-z0-9/+=]{40}\b`)},
+	{secretGitHubToken, regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{secretJWT, regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+}
+
+// tokenPattern matches the candidates of the entropy check: runs of the
+// characters of base64 and its URL-safe variant. Path separators and padding
+// split candidates, so that paths are checked segment by segment.
+var tokenPattern = regexp.MustCompile(`[A-Za-z0-9+_-]{24,}`)
+
+// urlPattern matches URLs, which are left out of the entropy check: their
+// paths and queries are full of IDs that look random without being secret.
+var urlPattern = regexp.MustCompile(`[A-Za-z][A-Za-z0-9+.-]*://\S+`)
+
+// minSecretEntropy is the entropy, in bits per character, above which a token
+// is taken for a random secret. Hex strings, such as commit hashes, stay
+// below it.
+const minSecretEntropy = 4.0
+
+// detectSecret returns the kind of secret that e looks like, or "" if none.
+// Only text is checked, and encrypted envelopes are never flagged: the
+// server can't read them anyway.
+func detectSecret(e Entry) string {
+	if !e.IsText() || envelope.IsSealed(string(e.Data)) {
+		return ""
+	}
+
+	text := string(e.Data)
+	for _, p := range secretPatterns {
+		if p.re.MatchString(text) {
+			return p.kind
+		}
+	}
+	for _, token := range tokenPattern.FindAllString(urlPattern.ReplaceAllString(text, " "), -1) {
+		if looksRandom(token) {
+			return secretHighEntropy
+		}
+	}
+	return ""
+}
+
+// looksRandom reports whether token mixes letters and digits with the
+// entropy of a generated secret.
+func looksRandom(token string) bool {
+	if !strings.ContainsAny(token, "0123456789") || strings.ToLower(token) == token || strings.ToUpper(token) == token {
+		return false
+	}
+	return entropy(token) > minSecretEntropy
+}
+
+// entropy returns the Shannon entropy of s, in bits per character.
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	n := float64(len(s))
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// rawContentPolicy is sent with raw clipboard content, which must never run
+// or load anything, even when opened directly.
+const rawContentPolicy = "sandbox; default-src 'none'"
+
+// scriptAssets are the scripts of the web UI.
+var scriptAssets = []string{"/app.js", "/crypto.js", "/sw.js"}
+
+// cspHost matches the hosts that a Content-Security-Policy source can name:
+// domain names and IPv4 addresses, with an optional port.
+var cspHost = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*(:[0-9]{1,5})?$`)
+
+// contentSecurityPolicy only lets the web UI served from host load its own
+// styles and images, plus the blob: URLs of decrypted files, and forbids
+// framing it. Clipboard content is served from the same origin, so scripts
+// are listed by path rather than trusted by origin. Hosts that a policy
+// can't name, such as IPv6 addresses, fall back to the origin.
+func contentSecurityPolicy(host string) string {
+	scripts := "'self'"
+	if cspHost.MatchString(host) {
+		sources := make([]string, len(scriptAssets))
+		for i, path := range scriptAssets {
+			sources[i] = host + path
+		}
+		scripts = strings.Join(sources, " ")
+	}
+	return "default-src 'self'; script-src " + scripts + "; img-src 'self' blob:; object-src 'none'; " +
+		"base-uri 'none'; form-action 'self'; frame-ancestors 'none'"
+}
+
+// setSecurityHeaders hardens every response to r. Nothing is cacheable:
+// responses may hold clipboard content, which can be a secret.
+func setSecurityHeaders(h http.Header, r *http.Request) {
+	h.Set("Content-Security-Policy", contentSecurityPolicy(r.Host))
+	h.Set("X-Frame-Options", "DENY")
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", "no-store")
+}
+
+// isSafeMethod reports whether method can't change the server state.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// isCrossOrigin reports whether a browser sent r from another site. Browsers
+// send Sec-Fetch-Site; older ones only send Origin, which must then match the
+// requested host. Requests with neither header come from other clients, such
+// as the CLI, and are let through.
+func isCrossOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		// "none" is a navigation started by the user, such as the share
+		// target of the installed app.
+		return false
+	case "":
+	default:
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return true
+	}
+	return !strings.EqualFold(u.Host, r.Host)
+}
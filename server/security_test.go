@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aldur/clipshare/api"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Set(DefaultChannel, "secret", "test")
+
+	s.snippets.Put("notes", api.Snippet{Name: "notes", Text: "hello"})
+
+	for target, policy := range map[string]string{
+		"/":                       contentSecurityPolicy("example.com"),
+		"/clipboard/qr":           contentSecurityPolicy("example.com"),
+		"/sw.js":                  contentSecurityPolicy("example.com"),
+		"/missing":                contentSecurityPolicy("example.com"),
+		"/clipboard?channel=../x": contentSecurityPolicy("example.com"),
+		"/clipboard":              rawContentPolicy,
+		"/snippets/notes":         rawContentPolicy,
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		for header, want := range map[string]string{
+			"Content-Security-Policy": policy,
+			"X-Frame-Options":         "DENY",
+			"Referrer-Policy":         "no-referrer",
+			"X-Content-Type-Options":  "nosniff",
+			"Cache-Control":           "no-store",
+		} {
+			if got := w.Header().Get(header); got != want {
+				t.Errorf("%s: expected %s %q, got %q", target, header, want, got)
+			}
+		}
+	}
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	policy := contentSecurityPolicy("clip.example.com:8080")
+	if !strings.Contains(policy, "; script-src clip.example.com:8080/app.js clip.example.com:8080/crypto.js clip.example.com:8080/sw.js;") {
+		t.Errorf("expected the scripts of the web UI to be listed by path, got %q", policy)
+	}
+	for _, host := range []string{"[::1]:8080", "a b; script-src *", ""} {
+		if policy := contentSecurityPolicy(host); !strings.Contains(policy, "; script-src 'self';") || strings.Count(policy, ";") != 6 {
+			t.Errorf("%q: expected a fallback to the origin, got %q", host, policy)
+		}
+	}
+}
+
+// TestIndexWithoutInlineCode checks that the web UI works under the
+// Content-Security-Policy, which forbids inline scripts, handlers and styles.
+func TestIndexWithoutInlineCode(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	body := w.Body.Bytes()
+	if regexp.MustCompile(`<script>|<style>|\son[a-z]+=|style=`).Match(body) {
+		t.Errorf("expected no inline code in index, got %s", body)
+	}
+	for _, asset := range []string{`src="/app.js"`, `src="/crypto.js"`, `href="/style.css"`} {
+		if !bytes.Contains(body, []byte(asset)) {
+			t.Errorf("expected index to load %s", asset)
+		}
+	}
+}
+
+func TestCrossOriginRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		allowed bool
+	}{
+		{"CLI", http.MethodPost, nil, true},
+		{"same origin", http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://clipshare.example"}, true},
+		{"user initiated", http.MethodPost, map[string]string{"Sec-Fetch-Site": "none"}, true},
+		{"cross site", http.MethodPost, map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://evil.example"}, false},
+		{"same site", http.MethodDelete, map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "http://other.clipshare.example"}, false},
+		{"matching origin", http.MethodPost, map[string]string{"Origin": "http://clipshare.example"}, true},
+		{"other origin", http.MethodDelete, map[string]string{"Origin": "http://evil.example"}, false},
+		{"null origin", http.MethodPost, map[string]string{"Origin": "null"}, false},
+		{"cross-site read", http.MethodGet, map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://evil.example"}, true},
+	}
+
+	for _, tt := range tests {
+		s, _ := newTestServer(t)
+
+		var body *strings.Reader
+		if tt.method == http.MethodPost {
+			body = strings.NewReader(`{"text":"from ` + tt.name + `"}`)
+		} else {
+			body = strings.NewReader("")
+		}
+		req := httptest.NewRequest(tt.method, "/clipboard", body)
+		req.Host = "clipshare.example"
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if tt.allowed && w.Code == http.StatusForbidden {
+			t.Errorf("%s: expected the request to be allowed", tt.name)
+		}
+		if !tt.allowed {
+			if w.Code != http.StatusForbidden {
+				t.Errorf("%s: expected status %d, got %d", tt.name, http.StatusForbidden, w.Code)
+			}
+			if tt.method == http.MethodPost && s.Content(DefaultChannel) != "" {
+				t.Errorf("%s: expected the clipboard to be left alone", tt.name)
+			}
+		}
+	}
+}
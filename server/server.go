@@ -0,0 +1,513 @@
+// Package server implements the clipshare HTTP server.
+//
+// A Server is an http.Handler and can be mounted into any existing mux:
+//
+//	srv := server.New(server.Options{})
+//	http.Handle("/", srv)
+package server
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"net/netip"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// DefaultTTL is how long the clipboard keeps its content when Options.TTL is
+// not set.
+const DefaultTTL = 60 * time.Second
+
+// TextMIMEType is the MIME type of content set as text.
+const TextMIMEType = "text/plain"
+
+// maxBodySize bounds the size of a set request.
+const maxBodySize = 32 << 20
+
+//go:embed index.html
+var indexHTML string
+
+var indexTemplate = template.Must(template.New("index").Parse(indexHTML))
+
+// Options configures a Server.
+type Options struct {
+	// TTL is how long content is kept before being cleared. Defaults to
+	// DefaultTTL.
+	TTL time.Duration
+
+	// SensitiveTTL is how long content that looks like a secret is kept,
+	// when shorter than TTL. Defaults to DefaultSensitiveTTL.
+	SensitiveTTL time.Duration
+
+	// Clock drives expiry. Defaults to the system clock.
+	Clock Clock
+
+	// Origin names this server among its peers. Defaults to the host name.
+	Origin string
+
+	// Peers are the base URLs of the servers that every set, clear and
+	// expiry is pushed to.
+	Peers []string
+
+	// PeerToken is the bearer token shared by peers. Replication, in both
+	// directions, is disabled when it is empty.
+	PeerToken string
+
+	// MaxPinDuration bounds how long pinned content is kept. Defaults to
+	// DefaultMaxPinDuration.
+	MaxPinDuration time.Duration
+
+	// AllowedOrigins lists the origins, such as "https://example.com" or
+	// "chrome-extension://<id>", whose pages may call the API from a
+	// browser. "*" allows every origin. CORS is disabled when empty.
+	AllowedOrigins []string
+
+	// TrustedProxies are the addresses of the proxies, such as Tailscale
+	// Serve, whose identity headers are honored. Requests of authenticated
+	// users get private channels, and the content they set records them.
+	TrustedProxies []netip.Prefix
+
+	// Webhooks are the targets that every set, clear and expiry is POSTed
+	// to, including the changes received from peers.
+	Webhooks []Webhook
+
+	// Snippets stores the named snippets. Defaults to a store that only
+	// keeps them in memory, see OpenSnippets. Snippets are not replicated.
+	Snippets *SnippetStore
+}
+
+// Server holds a set of named clipboards, called channels, and serves them
+// over HTTP.
+type Server struct {
+	ttl          time.Duration
+	sensitiveTTL time.Duration
+	maxPin       time.Duration
+	clock        Clock
+	mux          *http.ServeMux
+
+	origin    string
+	peerToken string
+	peers     []*peer
+	peersDone sync.WaitGroup
+
+	webhooks     []*webhook
+	webhooksDone sync.WaitGroup
+
+	snippets *SnippetStore
+
+	// done is closed by Close, to stop retrying deliveries.
+	done chan struct{}
+
+	allowedOrigins map[string]bool
+	trustedProxies []netip.Prefix
+
+	mu       sync.RWMutex
+	channels map[string]*clipboard
+	// versions holds the last change of every channel, including emptied
+	// ones, to order the changes received from peers.
+	versions        map[string]version
+	timerGeneration int64
+	subscribers     map[chan api.Event]string
+	closed          bool
+}
+
+// Entry is the content of a channel.
+type Entry struct {
+	Data []byte
+
+	// Filename is set for uploaded files.
+	Filename string
+	MIMEType string
+	Device   string
+
+	// Sensitive marks content that looks like a secret, such as a private
+	// key or an API token. It is kept for a shorter time and masked by the
+	// web UI. The server flags the secrets it detects on its own.
+	Sensitive bool
+
+	// User set the content, when authenticated by a trusted proxy. Unlike
+	// Device, which clients pick freely, it can be relied upon.
+	User api.User
+}
+
+// IsText reports whether the entry holds text rather than a binary file.
+func (e Entry) IsText() bool {
+	return strings.HasPrefix(e.MIMEType, "text/")
+}
+
+// clipboard is the content of a single channel. Channels only exist while
+// they hold content.
+type clipboard struct {
+	Entry
+	expiresAt  time.Time
+	clearTimer Timer
+	generation int64
+
+	// pinned is set while the content is kept past the TTL, until
+	// expiresAt.
+	pinned bool
+	// pinnedAt is when the content was first pinned. Renewed pins can't
+	// keep it for longer than the maximum pin duration from then.
+	pinnedAt time.Time
+}
+
+// event describes the content of c as an event of the given type.
+func (c *clipboard) event(typ, channel string) api.Event {
+	ev := c.Entry.event(typ, channel)
+	ev.ExpiresAt = c.expiresAt
+	ev.Pinned = c.pinned
+	return ev
+}
+
+// New returns a Server with an empty clipboard.
+func New(opts Options) *Server {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.MaxPinDuration <= 0 {
+		opts.MaxPinDuration = DefaultMaxPinDuration
+	}
+	if opts.SensitiveTTL <= 0 {
+		opts.SensitiveTTL = DefaultSensitiveTTL
+	}
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+	if opts.Origin == "" {
+		opts.Origin = defaultOrigin()
+	}
+	if opts.Snippets == nil {
+		opts.Snippets = newSnippetStore("")
+	}
+
+	s := &Server{
+		ttl:          opts.TTL,
+		sensitiveTTL: min(opts.SensitiveTTL, opts.TTL),
+		maxPin:       opts.MaxPinDuration,
+		clock:        opts.Clock,
+		mux:          http.NewServeMux(),
+		origin:       opts.Origin,
+		peerToken:    opts.PeerToken,
+		snippets:     opts.Snippets,
+		channels:     make(map[string]*clipboard),
+		versions:     make(map[string]version),
+		subscribers:  make(map[chan api.Event]string),
+
+		allowedOrigins: make(map[string]bool),
+		trustedProxies: opts.TrustedProxies,
+		done:           make(chan struct{}),
+	}
+	for _, origin := range opts.AllowedOrigins {
+		s.allowedOrigins[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	s.mux.HandleFunc("/", s.indexHandler)
+	s.mux.HandleFunc("/clipboard", s.clipboardHandler)
+	s.mux.HandleFunc("/clipboard/events", s.eventsHandler)
+	s.mux.HandleFunc("/clipboard/qr", s.clipboardQRHandler)
+	s.mux.HandleFunc("/clipboard/pin", s.pinHandler)
+	s.mux.HandleFunc("/qr/server", s.serverQRHandler)
+	s.mux.HandleFunc("/channels", s.channelsHandler)
+	s.mux.HandleFunc("/snippets", s.snippetsHandler)
+	s.mux.HandleFunc("/snippets/{name}", s.snippetHandler)
+	s.mux.HandleFunc("/share", s.shareHandler)
+	s.mux.HandleFunc("/openapi.yaml", s.specHandler)
+	s.mux.HandleFunc("/docs", s.docsHandler)
+
+	s.mux.Handle("/api", apiErrors(s.discoveryHandler))
+	s.mux.Handle("/api/", apiErrors(http.NotFound))
+	s.mux.Handle("/api/v1/clipboard", apiErrors(s.v1ClipboardHandler))
+	s.mux.Handle("/api/v1/clipboard/events", apiErrors(s.eventsHandler))
+	s.mux.Handle("/api/v1/clipboard/qr", apiErrors(s.clipboardQRHandler))
+	s.mux.Handle("/api/v1/clipboard/pin", apiErrors(s.v1PinHandler))
+	s.mux.Handle("/api/v1/channels", apiErrors(s.v1ChannelsHandler))
+	s.mux.Handle("/api/v1/snippets", apiErrors(s.v1SnippetsHandler))
+	s.mux.Handle("/api/v1/snippets/{name}", apiErrors(s.v1SnippetHandler))
+
+	assets := staticHandler()
+	s.mux.Handle("/manifest.webmanifest", assets)
+	s.mux.Handle("/sw.js", assets)
+	s.mux.Handle("/crypto.js", assets)
+	s.mux.Handle("/app.js", assets)
+	s.mux.Handle("/style.css", assets)
+	s.mux.Handle("/icons/", assets)
+
+	if s.peerToken != "" {
+		s.mux.HandleFunc("/replicate", s.replicationHandler)
+		s.startPeers(opts.Peers)
+	}
+	s.startWebhooks(opts.Webhooks)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w.Header(), r)
+	r = s.identify(r)
+
+	origin := r.Header.Get("Origin")
+	allowed := origin != "" && isAPIPath(r.URL.Path) && s.allowsOrigin(origin)
+	if allowed && s.handleCORS(w, r) {
+		return
+	}
+
+	// Keep other sites from changing the clipboard through the browsers of
+	// its users.
+	if !isSafeMethod(r.Method) && !allowed && isCrossOrigin(r) {
+		http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// Content returns the current content of a channel.
+func (s *Server) Content(channel string) string {
+	e, _ := s.Get(channel)
+	return string(e.Data)
+}
+
+// Get returns the entry of a channel, reporting false if it is empty.
+func (s *Server) Get(channel string) (Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if c, ok := s.channels[channel]; ok {
+		return c.Entry, true
+	}
+	return Entry{}, false
+}
+
+// lookup returns the entry of a channel, when it expires and whether it is
+// pinned, reporting false if it is empty.
+func (s *Server) lookup(channel string) (Entry, time.Time, bool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if c, ok := s.channels[channel]; ok {
+		return c.Entry, c.expiresAt, c.pinned, true
+	}
+	return Entry{}, time.Time{}, false, false
+}
+
+// Set replaces the content of a channel with text and restarts its expiry
+// timer.
+func (s *Server) Set(channel, text, device string) {
+	s.SetEntry(channel, Entry{Data: []byte(text), MIMEType: TextMIMEType, Device: device})
+}
+
+// SetEntry replaces the content of a channel and restarts its expiry timer.
+func (s *Server) SetEntry(channel string, e Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := s.nextVersion(channel)
+	e = s.setLocked(channel, e, v)
+	s.replicate(replication{
+		Type:      api.EventSet,
+		Channel:   channel,
+		version:   v,
+		Data:      e.Data,
+		Filename:  e.Filename,
+		MIMEType:  e.MIMEType,
+		Device:    e.Device,
+		Sensitive: e.Sensitive,
+		User:      e.User,
+	})
+}
+
+// setLocked stores e, flagged as sensitive if it looks like a secret, and
+// returns it. It must be called with s.mu held.
+func (s *Server) setLocked(channel string, e Entry, v version) Entry {
+	c, ok := s.channels[channel]
+	if !ok {
+		c = &clipboard{}
+		s.channels[channel] = c
+	}
+
+	ttl := s.ttl
+	if !e.Sensitive {
+		e.Sensitive = detectSecret(e) != ""
+	}
+	if e.Sensitive {
+		ttl = s.sensitiveTTL
+	}
+
+	c.Entry = e
+	c.pinned = false
+	c.pinnedAt = time.Time{}
+	s.versions[channel] = v
+	s.expireAtLocked(channel, c, s.clock.Now().Add(ttl))
+
+	s.publish(c.event(api.EventSet, channel))
+	s.notify(api.EventSet, channel, e, c.expiresAt)
+	return e
+}
+
+// expireAtLocked (re)starts the expiry timer of c, so that it is cleared
+// at the given time. It must be called with s.mu held.
+func (s *Server) expireAtLocked(channel string, c *clipboard, at time.Time) {
+	c.expiresAt = at
+	if c.clearTimer != nil {
+		c.clearTimer.Stop()
+	}
+
+	s.timerGeneration++
+	currentGen := s.timerGeneration
+	c.generation = currentGen
+	c.clearTimer = s.clock.AfterFunc(at.Sub(s.clock.Now()), func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if c, ok := s.channels[channel]; ok && c.generation == currentGen {
+			s.expireLocked(channel)
+			s.replicate(replication{Type: api.EventExpire, Channel: channel, version: s.versions[channel]})
+		}
+	})
+}
+
+// expireLocked empties a channel whose content timed out. Its version is
+// kept, so that the expired content can't come back from a peer. It must be
+// called with s.mu held.
+func (s *Server) expireLocked(channel string) {
+	if c, ok := s.channels[channel]; ok && c.clearTimer != nil {
+		c.clearTimer.Stop()
+	}
+	delete(s.channels, channel)
+	s.publish(api.Event{Type: api.EventExpire, Channel: channel})
+	s.notify(api.EventExpire, channel, Entry{}, time.Time{})
+}
+
+// Clear empties a channel and cancels its expiry timer.
+func (s *Server) Clear(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := s.nextVersion(channel)
+	s.clearLocked(channel, v)
+	s.replicate(replication{Type: api.EventClear, Channel: channel, version: v})
+}
+
+// clearLocked must be called with s.mu held.
+func (s *Server) clearLocked(channel string, v version) {
+	if c, ok := s.channels[channel]; ok {
+		if c.clearTimer != nil {
+			c.clearTimer.Stop()
+		}
+		// Removing the channel also invalidates a timer that already fired
+		// and is waiting on the lock.
+		delete(s.channels, channel)
+	}
+	s.versions[channel] = v
+
+	s.publish(api.Event{Type: api.EventClear, Channel: channel})
+	s.notify(api.EventClear, channel, Entry{}, time.Time{})
+}
+
+func (s *Server) clipboardHandler(w http.ResponseWriter, r *http.Request) {
+	channel, ok := channelFromRequest(r)
+	if !ok {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.writeContent(w, r, channel)
+
+	case http.MethodPost:
+		req, ok := readSetRequest(w, r)
+		if !ok {
+			return
+		}
+
+		s.SetEntry(channel, entryFromRequest(r, req))
+
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodDelete:
+		s.Clear(channel)
+
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// entryFromRequest turns a set request, made by r, into an entry. File
+// names are stripped of any directory.
+func entryFromRequest(r *http.Request, req api.SetRequest) Entry {
+	user, _ := userFromRequest(r)
+	if !req.IsFile() {
+		return Entry{Data: []byte(req.Text), MIMEType: TextMIMEType, Device: req.Device, User: user}
+	}
+
+	e := Entry{Data: req.Data, MIMEType: req.MIMEType, Device: req.Device, User: user}
+	if e.MIMEType == "" {
+		e.MIMEType = "application/octet-stream"
+	}
+	if req.Filename != "" {
+		name := path.Base(strings.ReplaceAll(req.Filename, "\\", "/"))
+		if name != "." && name != "/" && name != ".." {
+			e.Filename = name
+		}
+	}
+	return e
+}
+
+// event describes e as an event of the given type. Binary content is left
+// out.
+func (e Entry) event(typ, channel string) api.Event {
+	ev := api.Event{
+		Type:      typ,
+		Channel:   channel,
+		Device:    e.Device,
+		Filename:  e.Filename,
+		MIMEType:  e.MIMEType,
+		Sensitive: e.Sensitive,
+		User:      e.User,
+	}
+	if e.IsText() {
+		ev.Text = string(e.Data)
+	}
+	return ev
+}
+
+func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	channel, ok := channelFromRequest(r)
+	if !ok {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return
+	}
+
+	// Files are shown by the page's script, which fetches them on its own.
+	// Secrets are left out of the page, which masks them until revealed.
+	var content string
+	if e, _ := s.Get(channel); e.IsText() && !e.Sensitive {
+		content = string(e.Data)
+	}
+
+	data := struct {
+		Content string
+		Channel string
+	}{content, channelName(channel)}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, data); err != nil {
+		http.Error(w, "Error rendering template", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,624 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// fakeClock only fires timers when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	when    time.Time
+	f       func()
+	stopped bool
+	fired   bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward and runs every timer that became due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []*fakeTimer
+	for _, t := range c.timers {
+		if !t.stopped && !t.fired && !t.when.After(c.now) {
+			t.fired = true
+			due = append(due, t)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, t := range due {
+		t.f()
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := !t.stopped && !t.fired
+	t.stopped = true
+	return active
+}
+
+func newTestServer(t *testing.T) (*Server, *fakeClock) {
+	t.Helper()
+
+	clock := newFakeClock()
+	return New(Options{TTL: time.Minute, Clock: clock}), clock
+}
+
+func postJSON(t *testing.T, s *Server, req api.SetRequest) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest(http.MethodPost, "/clipboard", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestClipboardGet(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(s *Server)
+		expected string
+	}{
+		{
+			name:     "empty clipboard",
+			setup:    func(s *Server) {},
+			expected: "",
+		},
+		{
+			name:     "with text",
+			setup:    func(s *Server) { s.Set(DefaultChannel, "test text", "test") },
+			expected: "test text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			tt.setup(s)
+
+			req := httptest.NewRequest(http.MethodGet, "/clipboard", nil)
+			w := httptest.NewRecorder()
+
+			s.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+
+			if w.Body.String() != tt.expected {
+				t.Errorf("expected body %q, got %q", tt.expected, w.Body.String())
+			}
+
+			if w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+				t.Errorf("expected Content-Type text/plain; charset=utf-8, got %s", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestClipboardPost(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           any
+		expectedStatus int
+		expectedText   string
+	}{
+		{
+			name:           "valid request",
+			body:           api.SetRequest{Text: "hello world", Device: "test"},
+			expectedStatus: http.StatusOK,
+			expectedText:   "hello world",
+		},
+		{
+			name:           "unknown device",
+			body:           api.SetRequest{Text: "test text", Device: "unknown"},
+			expectedStatus: http.StatusOK,
+			expectedText:   "test text",
+		},
+		{
+			name:           "invalid JSON",
+			body:           "invalid json",
+			expectedStatus: http.StatusBadRequest,
+			expectedText:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+
+			var body bytes.Buffer
+			if str, ok := tt.body.(string); ok {
+				body.WriteString(str)
+			} else {
+				json.NewEncoder(&body).Encode(tt.body)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/clipboard", &body)
+			w := httptest.NewRecorder()
+
+			s.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if got := s.Content(DefaultChannel); got != tt.expectedText {
+				t.Errorf("expected clipboard %q, got %q", tt.expectedText, got)
+			}
+		})
+	}
+}
+
+func TestClipboardMethodNotAllowed(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPut, "/clipboard", nil)
+	w := httptest.NewRecorder()
+
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestIntegration(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	testText := "integration test text"
+
+	w := postJSON(t, s, api.SetRequest{Text: testText, Device: "test-device"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("set request failed with status %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/clipboard", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("get request failed with status %d", w.Code)
+	}
+
+	if w.Body.String() != testText {
+		t.Errorf("expected %q, got %q", testText, w.Body.String())
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	const numGoroutines = 10
+	const testText = "concurrent test"
+
+	postJSON(t, s, api.SetRequest{Text: testText, Device: "test"})
+
+	done := make(chan bool, numGoroutines)
+
+	for range numGoroutines {
+		go func() {
+			req := httptest.NewRequest(http.MethodGet, "/clipboard", nil)
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+
+			if w.Body.String() != testText {
+				t.Errorf("concurrent read failed: expected %q, got %q", testText, w.Body.String())
+			}
+			done <- true
+		}()
+	}
+
+	for range numGoroutines {
+		<-done
+	}
+}
+
+func TestAutoClear(t *testing.T) {
+	s, clock := newTestServer(t)
+
+	testText := "auto clear test"
+	w := postJSON(t, s, api.SetRequest{Text: testText, Device: "test"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// Verify content is set
+	if got := s.Content(DefaultChannel); got != testText {
+		t.Errorf("expected clipboard %q, got %q", testText, got)
+	}
+
+	// Timer should still be active, content should remain
+	clock.Advance(time.Minute - time.Second)
+	if got := s.Content(DefaultChannel); got != testText {
+		t.Errorf("clipboard cleared too early: expected %q, got %q", testText, got)
+	}
+
+	clock.Advance(time.Second)
+	if got := s.Content(DefaultChannel); got != "" {
+		t.Errorf("expected clipboard to be cleared after TTL, got %q", got)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	clock := newFakeClock()
+	s := New(Options{Clock: clock})
+
+	s.Set(DefaultChannel, "default ttl", "test")
+
+	clock.Advance(DefaultTTL - time.Second)
+	if got := s.Content(DefaultChannel); got != "default ttl" {
+		t.Errorf("clipboard cleared too early: got %q", got)
+	}
+
+	clock.Advance(time.Second)
+	if got := s.Content(DefaultChannel); got != "" {
+		t.Errorf("expected clipboard to be cleared after DefaultTTL, got %q", got)
+	}
+}
+
+func TestMultipleSetsCancelPreviousTimer(t *testing.T) {
+	s, clock := newTestServer(t)
+
+	// Set first text
+	postJSON(t, s, api.SetRequest{Text: "first text", Device: "test"})
+
+	clock.Advance(30 * time.Second)
+
+	// Set second text before the first one expires
+	secondText := "second text"
+	postJSON(t, s, api.SetRequest{Text: secondText, Device: "test"})
+
+	// The first timer would have fired by now
+	clock.Advance(45 * time.Second)
+
+	// Verify second text is set
+	if got := s.Content(DefaultChannel); got != secondText {
+		t.Errorf("expected clipboard %q, got %q", secondText, got)
+	}
+}
+
+func TestConcurrentSets(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	const numGoroutines = 5
+	done := make(chan string, numGoroutines)
+
+	// Launch concurrent set operations
+	for i := range numGoroutines {
+		go func(id int) {
+			testText := fmt.Sprintf("concurrent set %d", id)
+			postJSON(t, s, api.SetRequest{Text: testText, Device: "test"})
+
+			done <- testText
+		}(i)
+	}
+
+	// Wait for all to complete
+	results := make([]string, numGoroutines)
+	for i := range numGoroutines {
+		results[i] = <-done
+	}
+
+	// One of the values should be the final clipboard content
+	found := slices.Contains(results, s.Content(DefaultChannel))
+
+	if !found {
+		t.Errorf("clipboard content %q not found in concurrent results %v", s.Content(DefaultChannel), results)
+	}
+}
+
+func TestOldTimerClearsNewContent(t *testing.T) {
+	s, clock := newTestServer(t)
+
+	// Simulate the exact race condition: the first timer fires and blocks on
+	// the mutex while the second POST is being processed, so stopping it has
+	// no effect and its callback runs after the new content is set.
+
+	firstText := "first text"
+	secondText := "second text"
+
+	s.Set(DefaultChannel, firstText, "test")
+	firstTimer := clock.timers[0]
+
+	s.Set(DefaultChannel, secondText, "test")
+
+	// Run the stale callback as if it had been waiting on the mutex.
+	firstTimer.f()
+
+	// The clipboard should still contain second text
+	// If it's empty, the old timer cleared it (race condition)
+	if got := s.Content(DefaultChannel); got != secondText {
+		t.Errorf("Race condition: expected %q, got %q", secondText, got)
+		t.Logf("This means the old timer cleared the new content")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Set(DefaultChannel, "<b>hello</b>", "test")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("&lt;b&gt;hello&lt;/b&gt;</textarea>")) {
+		t.Errorf("expected escaped clipboard content in index, got %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/missing", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestIndexFile(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.SetEntry(DefaultChannel, Entry{Data: []byte("\x89PNG secret"), Filename: "shot.png", MIMEType: "image/png"})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if !bytes.Contains(w.Body.Bytes(), []byte(`placeholder="(clipboard is empty)"></textarea>`)) {
+		t.Errorf("expected binary content to be left out of the textarea, got %s", w.Body.String())
+	}
+}
+
+func TestIndependentServers(t *testing.T) {
+	a, _ := newTestServer(t)
+	b, _ := newTestServer(t)
+
+	a.Set(DefaultChannel, "only on a", "test")
+
+	if got := b.Content(DefaultChannel); got != "" {
+		t.Errorf("expected servers not to share state, got %q", got)
+	}
+}
+
+func TestClipboardDelete(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.Set(DefaultChannel, "to be cleared", "test")
+
+	req := httptest.NewRequest(http.MethodDelete, "/clipboard", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := s.Content(DefaultChannel); got != "" {
+		t.Errorf("expected empty clipboard, got %q", got)
+	}
+
+	// A stale expiry must not clear content set afterwards.
+	s.Set(DefaultChannel, "new content", "test")
+	clock.timers[0].f()
+	if got := s.Content(DefaultChannel); got != "new content" {
+		t.Errorf("expected %q, got %q", "new content", got)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	s, clock := newTestServer(t)
+	s.Set(DefaultChannel, "initial", "laptop")
+
+	events, unsubscribe := s.Subscribe(DefaultChannel)
+	defer unsubscribe()
+
+	s.Set(DefaultChannel, "next", "phone")
+	clock.Advance(time.Minute)
+	s.Set(DefaultChannel, "again", "phone")
+	s.Clear(DefaultChannel)
+
+	start := newFakeClock().Now()
+	expected := []api.Event{
+		{Type: api.EventSnapshot, Channel: DefaultChannel, Text: "initial", Device: "laptop", MIMEType: TextMIMEType, ExpiresAt: start.Add(time.Minute)},
+		{Type: api.EventSet, Channel: DefaultChannel, Text: "next", Device: "phone", MIMEType: TextMIMEType, ExpiresAt: start.Add(time.Minute)},
+		{Type: api.EventExpire, Channel: DefaultChannel},
+		{Type: api.EventSet, Channel: DefaultChannel, Text: "again", Device: "phone", MIMEType: TextMIMEType, ExpiresAt: start.Add(2 * time.Minute)},
+		{Type: api.EventClear, Channel: DefaultChannel},
+	}
+	for i, want := range expected {
+		if got := <-events; got != want {
+			t.Errorf("event %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	unsubscribe()
+	if _, ok := <-events; ok {
+		t.Error("expected the channel to be closed after unsubscribing")
+	}
+}
+
+func TestEventsEndpoint(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Set(DefaultChannel, "streamed", "test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/clipboard/events", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		s.ServeHTTP(w, req)
+		close(done)
+	}()
+
+	// Give the handler time to write the snapshot before stopping it.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected Content-Type text/event-stream, got %s", ct)
+	}
+	expected := "event: snapshot\ndata: {\"type\":\"snapshot\",\"channel\":\"default\",\"text\":\"streamed\",\"device\":\"test\",\"mime_type\":\"text/plain\",\"expires_at\":\"2025-01-01T00:01:00Z\"}\n\n"
+	if w.Body.String() != expected {
+		t.Errorf("expected body %q, got %q", expected, w.Body.String())
+	}
+}
+
+func TestChannels(t *testing.T) {
+	s, clock := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	body, _ := json.Marshal(api.SetRequest{Text: "on work", Device: "test"})
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/clipboard?channel=work", bytes.NewBuffer(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	s.Set(DefaultChannel, "on default", "test")
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/clipboard?channel=work", nil))
+	if w.Body.String() != "on work" {
+		t.Errorf("expected %q, got %q", "on work", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/clipboard", nil))
+	if w.Body.String() != "on default" {
+		t.Errorf("expected %q, got %q", "on default", w.Body.String())
+	}
+
+	s.Clear("work")
+	if got := s.Content(DefaultChannel); got != "on default" {
+		t.Errorf("clearing a channel affected another one: got %q", got)
+	}
+
+	clock.Advance(time.Minute)
+	if len(s.channels) != 0 {
+		t.Errorf("expected expired channels to be removed, got %d", len(s.channels))
+	}
+}
+
+func TestInvalidChannel(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	for _, path := range []string{"/clipboard?channel=a/b", "/clipboard/events?channel=%20", "/?channel=%3Cb%3E"} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestClipboardFile(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	w := postJSON(t, s, api.SetRequest{
+		Data:     []byte("%PDF-1.7"),
+		Filename: "../../reports/q3 report.pdf",
+		MIMEType: "application/pdf",
+		Device:   "laptop",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/clipboard", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Body.String() != "%PDF-1.7" {
+		t.Errorf("expected file content, got %q", w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("expected Content-Type application/pdf, got %s", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="q3 report.pdf"` {
+		t.Errorf("unexpected Content-Disposition %s", cd)
+	}
+
+	postJSON(t, s, api.SetRequest{Data: []byte{}, Filename: ".."})
+	if e, _ := s.Get(DefaultChannel); e.Filename != "" || e.MIMEType != "application/octet-stream" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+}
+
+func TestClipboardPostTooLarge(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	body := bytes.Repeat([]byte("a"), maxBodySize+1)
+	req := httptest.NewRequest(http.MethodPost, "/clipboard", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func TestChannelsEndpoint(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Set("work", "a", "test")
+	s.Set(DefaultChannel, "b", "test")
+	s.Set("empty", "c", "test")
+	s.Clear("empty")
+
+	req := httptest.NewRequest(http.MethodGet, "/channels", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %s", ct)
+	}
+
+	var channels []string
+	if err := json.Unmarshal(w.Body.Bytes(), &channels); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !slices.Equal(channels, []string{"default", "work"}) {
+		t.Errorf("unexpected channels %v", channels)
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// DeviceHeader names the device setting raw content, which has no other
+// place for it. The "device" query parameter works as well.
+const DeviceHeader = "X-Clipshare-Device"
+
+// formFileField is the form field holding an uploaded file.
+const formFileField = "file"
+
+// readSetRequest reads the body of a set, according to its Content-Type:
+//
+//   - application/json, the default: an api.SetRequest.
+//   - text/plain: the text itself.
+//   - application/octet-stream: the content of a file, named by the
+//     "filename" query parameter or the Content-Disposition header.
+//   - application/x-www-form-urlencoded and multipart/form-data: the fields
+//     of an api.SetRequest, and a file in the "file" field.
+//
+// The device defaults to DeviceHeader, then to the "device" query
+// parameter. On errors, it answers the request and reports false.
+func readSetRequest(w http.ResponseWriter, r *http.Request) (api.SetRequest, bool) {
+	var req api.SetRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+	mediaType := ""
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(ct); err != nil {
+			http.Error(w, "Invalid Content-Type", http.StatusBadRequest)
+			return req, false
+		}
+	}
+
+	var err error
+	message := "Error reading request body"
+	switch mediaType {
+	case "", "application/json":
+		var body []byte
+		if body, err = io.ReadAll(r.Body); err == nil {
+			if err = json.Unmarshal(body, &req); err != nil {
+				message = "Invalid JSON"
+			}
+		}
+
+	case "text/plain":
+		var body []byte
+		if body, err = io.ReadAll(r.Body); err == nil {
+			req.Text = string(body)
+		}
+
+	case "application/octet-stream":
+		if req.Data, err = io.ReadAll(r.Body); err == nil {
+			req.MIMEType = mediaType
+			req.Filename = rawFilename(r)
+		}
+
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		message = "Invalid form"
+		req, err = readSetForm(r, mediaType)
+
+	default:
+		http.Error(w, "Unsupported Content-Type", http.StatusUnsupportedMediaType)
+		return req, false
+	}
+
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return req, false
+		}
+		http.Error(w, message, http.StatusBadRequest)
+		return req, false
+	}
+
+	if req.Device == "" {
+		req.Device = r.Header.Get(DeviceHeader)
+	}
+	if req.Device == "" {
+		req.Device = r.URL.Query().Get("device")
+	}
+	return req, true
+}
+
+// rawFilename returns the name of a file sent as the request body.
+func rawFilename(r *http.Request) string {
+	if name := r.URL.Query().Get("filename"); name != "" {
+		return name
+	}
+	_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Disposition"))
+	return params["filename"]
+}
+
+// readSetForm reads a set from the fields of a form.
+func readSetForm(r *http.Request, mediaType string) (api.SetRequest, error) {
+	var req api.SetRequest
+
+	if mediaType == "application/x-www-form-urlencoded" {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return req, err
+		}
+		// curl -d sends JSON as a form unless told otherwise.
+		if bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+			return req, json.Unmarshal(body, &req)
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return req, err
+		}
+		req.Text = form.Get("text")
+		req.Device = form.Get("device")
+		return req, nil
+	}
+
+	if err := r.ParseMultipartForm(maxBodySize); err != nil {
+		return req, err
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	req.Text = r.PostFormValue("text")
+	req.Device = r.PostFormValue("device")
+	if fh := formFile(r.MultipartForm, formFileField); fh != nil {
+		if err := readFormFile(fh, &req); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// formFile returns the first file uploaded in a field of form, or nil.
+func formFile(form *multipart.Form, field string) *multipart.FileHeader {
+	if form == nil || len(form.File[field]) == 0 {
+		return nil
+	}
+	return form.File[field][0]
+}
+
+// readFormFile reads an uploaded file into a set request.
+func readFormFile(fh *multipart.FileHeader, req *api.SetRequest) error {
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if req.Data, err = io.ReadAll(f); err != nil {
+		return err
+	}
+	req.Filename = fh.Filename
+	req.MIMEType = fh.Header.Get("Content-Type")
+	return nil
+}
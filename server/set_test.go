@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// multipartForm builds a multipart POST request with the given fields and,
+// if filename is set, a file part named field.
+func multipartForm(t *testing.T, target string, fields map[string]string, field, filename, mimeType string, data []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	if filename != "" {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="`+field+`"; filename="`+filename+`"`)
+		h.Set("Content-Type", mimeType)
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(data)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestSetContentTypes(t *testing.T) {
+	raw := func(target, contentType, body string, header map[string]string) *http.Request {
+		req := specRequest(http.MethodPost, target, contentType, body)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want Entry
+	}{
+		{
+			name: "json without Content-Type",
+			req:  raw("/clipboard", "", `{"text":"hello","device":"laptop"}`, nil),
+			want: Entry{Data: []byte("hello"), MIMEType: TextMIMEType, Device: "laptop"},
+		},
+		{
+			name: "json",
+			req:  raw("/clipboard?device=ignored", "application/json; charset=utf-8", `{"text":"hello","device":"laptop"}`, nil),
+			want: Entry{Data: []byte("hello"), MIMEType: TextMIMEType, Device: "laptop"},
+		},
+		{
+			name: "json without device",
+			req:  raw("/clipboard?device=phone", "application/json", `{"text":"hello"}`, nil),
+			want: Entry{Data: []byte("hello"), MIMEType: TextMIMEType, Device: "phone"},
+		},
+		{
+			name: "text",
+			req:  raw("/clipboard?device=phone", "text/plain; charset=utf-8", "line 1\nline 2\n", nil),
+			want: Entry{Data: []byte("line 1\nline 2\n"), MIMEType: TextMIMEType, Device: "phone"},
+		},
+		{
+			name: "text with device header",
+			req:  raw("/clipboard?device=phone", "text/plain", "hello", map[string]string{DeviceHeader: "laptop"}),
+			want: Entry{Data: []byte("hello"), MIMEType: TextMIMEType, Device: "laptop"},
+		},
+		{
+			name: "binary",
+			req:  raw("/clipboard?filename=dir/a.bin", "application/octet-stream", "\x00\x01", nil),
+			want: Entry{Data: []byte{0, 1}, Filename: "a.bin", MIMEType: "application/octet-stream"},
+		},
+		{
+			name: "binary with Content-Disposition",
+			req:  raw("/clipboard", "application/octet-stream", "\x00\x01", map[string]string{"Content-Disposition": `attachment; filename="b.bin"`}),
+			want: Entry{Data: []byte{0, 1}, Filename: "b.bin", MIMEType: "application/octet-stream"},
+		},
+		{
+			name: "empty binary",
+			req:  raw("/clipboard", "application/octet-stream", "", nil),
+			want: Entry{Data: []byte{}, MIMEType: "application/octet-stream"},
+		},
+		{
+			name: "urlencoded form",
+			req:  raw("/clipboard", "application/x-www-form-urlencoded", "text=a+b%26c&device=form", nil),
+			want: Entry{Data: []byte("a b&c"), MIMEType: TextMIMEType, Device: "form"},
+		},
+		{
+			name: "json sent by curl -d",
+			req:  raw("/clipboard", "application/x-www-form-urlencoded", `{"text":"hello","device":"curl"}`, nil),
+			want: Entry{Data: []byte("hello"), MIMEType: TextMIMEType, Device: "curl"},
+		},
+		{
+			name: "multipart form",
+			req:  multipartForm(t, "/clipboard", map[string]string{"text": "hello", "device": "form"}, "file", "", "", nil),
+			want: Entry{Data: []byte("hello"), MIMEType: TextMIMEType, Device: "form"},
+		},
+		{
+			name: "multipart file",
+			req:  multipartForm(t, "/api/v1/clipboard", map[string]string{"text": "ignored"}, "file", "shot.png", "image/png", []byte("\x89PNG")),
+			want: Entry{Data: []byte("\x89PNG"), Filename: "shot.png", MIMEType: "image/png"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, tt.req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+			}
+
+			e, _ := s.Get(DefaultChannel)
+			if !bytes.Equal(e.Data, tt.want.Data) || e.Filename != tt.want.Filename || e.MIMEType != tt.want.MIMEType || e.Device != tt.want.Device {
+				t.Errorf("expected %+v, got %+v", tt.want, e)
+			}
+		})
+	}
+}
+
+func TestSetContentTypeErrors(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		contentType, body string
+		status            int
+	}{
+		{"image/png", "\x89PNG", http.StatusUnsupportedMediaType},
+		{"text/plain; charset", "hello", http.StatusBadRequest},
+		{"application/x-www-form-urlencoded", "text=%zz", http.StatusBadRequest},
+		{"multipart/form-data", "text", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := specRequest(http.MethodPost, "/clipboard", tt.contentType, tt.body)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.contentType, tt.status, w.Code)
+		}
+	}
+
+	body := strings.Repeat("a", maxBodySize+1)
+	for _, contentType := range []string{"text/plain", "application/octet-stream", "application/x-www-form-urlencoded"} {
+		req := specRequest(http.MethodPost, "/clipboard", contentType, body)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected status %d, got %d", contentType, http.StatusRequestEntityTooLarge, w.Code)
+		}
+	}
+	if s.Content(DefaultChannel) != "" {
+		t.Errorf("expected failed sets to leave the clipboard alone, got %q", s.Content(DefaultChannel))
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// maxSnippetSize bounds the text of a snippet.
+const maxSnippetSize = 64 << 10
+
+// SnippetStore holds named snippets. Unlike the clipboard, snippets never
+// expire: they are kept until deleted, and written to a file so that they
+// survive restarts.
+//
+// Snippets are stored under the same keys as channels: the snippets of users
+// authenticated by a trusted proxy are private, and stored as "login/name".
+type SnippetStore struct {
+	path string
+
+	mu       sync.RWMutex
+	snippets map[string]api.Snippet
+}
+
+// OpenSnippets returns a store persisted to the JSON file at path, holding
+// the snippets already saved there. The file is created on the first change.
+// With an empty path, snippets are only kept in memory.
+func OpenSnippets(path string) (*SnippetStore, error) {
+	st := newSnippetStore(path)
+	if path == "" {
+		return st, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snippets map[string]api.Snippet
+	if err := json.Unmarshal(data, &snippets); err != nil {
+		return nil, fmt.Errorf("invalid snippets file %s: %w", path, err)
+	}
+	for key, sn := range snippets {
+		if !validChannelKey(key) || channelName(key) != sn.Name {
+			return nil, fmt.Errorf("invalid snippets file %s: invalid key %q", path, key)
+		}
+		st.snippets[key] = sn
+	}
+	return st, nil
+}
+
+func newSnippetStore(path string) *SnippetStore {
+	return &SnippetStore{path: path, snippets: make(map[string]api.Snippet)}
+}
+
+// Get returns the snippet stored under key, reporting false if there is
+// none.
+func (st *SnippetStore) Get(key string) (api.Snippet, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	sn, ok := st.snippets[key]
+	return sn, ok
+}
+
+// List returns the snippets of the user with the given login, or the shared
+// snippets for an empty login, sorted by name.
+func (st *SnippetStore) List(login string) []api.Snippet {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	snippets := []api.Snippet{}
+	for key, sn := range st.snippets {
+		if channelScope(key) == login {
+			snippets = append(snippets, sn)
+		}
+	}
+	sort.Slice(snippets, func(i, j int) bool { return snippets[i].Name < snippets[j].Name })
+	return snippets
+}
+
+// Put stores sn under key, replacing the snippet already there. The change
+// is undone if it can't be saved.
+func (st *SnippetStore) Put(key string, sn api.Snippet) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	old, existed := st.snippets[key]
+	st.snippets[key] = sn
+	if err := st.saveLocked(); err != nil {
+		if existed {
+			st.snippets[key] = old
+		} else {
+			delete(st.snippets, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the snippet stored under key and returns it, reporting
+// false if there was none. The change is undone if it can't be saved.
+func (st *SnippetStore) Delete(key string) (api.Snippet, bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	sn, ok := st.snippets[key]
+	if !ok {
+		return api.Snippet{}, false, nil
+	}
+	delete(st.snippets, key)
+	if err := st.saveLocked(); err != nil {
+		st.snippets[key] = sn
+		return api.Snippet{}, false, err
+	}
+	return sn, true, nil
+}
+
+// saveLocked writes the snippets to the file of the store, replacing it
+// atomically so that a crash can't leave it truncated. It must be called
+// with st.mu held.
+func (st *SnippetStore) saveLocked() error {
+	if st.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(st.snippets, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Snippets may hold credentials, so the file is only readable by the
+	// server, as created by CreateTemp.
+	f, err := os.CreateTemp(filepath.Dir(st.path), ".snippets-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), st.path)
+}
+
+// snippetFromRequest returns the key of the snippet named in the path of r,
+// scoped to its user like channels are, and its name. It reports false for
+// invalid names.
+func snippetFromRequest(r *http.Request) (key, name string, ok bool) {
+	name = r.PathValue("name")
+	if name == "" || !validChannel(name) {
+		return "", "", false
+	}
+	if user, ok := userFromRequest(r); ok {
+		return scopeChannel(user, name), name, true
+	}
+	return name, name, true
+}
+
+// snippetsOf returns the snippets that r may see: the private ones of its
+// user, or the shared ones for anonymous requests.
+func (s *Server) snippetsOf(r *http.Request) []api.Snippet {
+	user, _ := userFromRequest(r)
+	return s.snippets.List(user.Login)
+}
+
+func (s *Server) snippetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.snippetsOf(r))
+}
+
+func (s *Server) v1SnippetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeData(w, s.snippetsOf(r))
+}
+
+// snippetHandler serves /snippets/{name}: GET returns the raw text of the
+// snippet, PUT saves it from a body read like a set, and DELETE removes it.
+func (s *Server) snippetHandler(w http.ResponseWriter, r *http.Request) {
+	sn, ok := s.snippet(w, r)
+	if ok && r.Method == http.MethodGet {
+		w.Header().Set("Content-Security-Policy", rawContentPolicy)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, sn.Text)
+	}
+}
+
+// v1SnippetHandler is /snippets/{name}, answering with the snippet.
+func (s *Server) v1SnippetHandler(w http.ResponseWriter, r *http.Request) {
+	if sn, ok := s.snippet(w, r); ok {
+		writeData(w, sn)
+	}
+}
+
+// snippet gets, saves or deletes the snippet named by r, and returns it. On
+// failure, it answers r and reports false.
+func (s *Server) snippet(w http.ResponseWriter, r *http.Request) (api.Snippet, bool) {
+	key, name, ok := snippetFromRequest(r)
+	if !ok {
+		http.Error(w, "Invalid snippet name", http.StatusBadRequest)
+		return api.Snippet{}, false
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		sn, ok := s.snippets.Get(key)
+		if !ok {
+			http.Error(w, "Snippet not found", http.StatusNotFound)
+		}
+		return sn, ok
+
+	case http.MethodPut:
+		req, ok := readSetRequest(w, r)
+		if !ok {
+			return api.Snippet{}, false
+		}
+		if req.IsFile() {
+			http.Error(w, "Snippets must be text", http.StatusUnsupportedMediaType)
+			return api.Snippet{}, false
+		}
+		if len(req.Text) > maxSnippetSize {
+			http.Error(w, "Snippet too large", http.StatusRequestEntityTooLarge)
+			return api.Snippet{}, false
+		}
+
+		user, _ := userFromRequest(r)
+		sn := api.Snippet{Name: name, Text: req.Text, Device: req.Device, User: user, UpdatedAt: s.clock.Now()}
+		if err := s.snippets.Put(key, sn); err != nil {
+			log.Printf("clipshare: failed to save snippet %q: %v", key, err)
+			http.Error(w, "Failed to save the snippet", http.StatusInternalServerError)
+			return api.Snippet{}, false
+		}
+		return sn, true
+
+	case http.MethodDelete:
+		sn, ok, err := s.snippets.Delete(key)
+		switch {
+		case err != nil:
+			log.Printf("clipshare: failed to delete snippet %q: %v", key, err)
+			http.Error(w, "Failed to save the snippets", http.StatusInternalServerError)
+			return api.Snippet{}, false
+		case !ok:
+			http.Error(w, "Snippet not found", http.StatusNotFound)
+			return api.Snippet{}, false
+		}
+		return sn, true
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return api.Snippet{}, false
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+func TestSnippets(t *testing.T) {
+	s, clock := newTestServer(t)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set(DeviceHeader, "laptop")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPut, "/snippets/standup", "https://meet.example.com/standup"); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	do(http.MethodPut, "/snippets/account", "test@example.com")
+
+	// Snippets outlive the clipboard.
+	clock.Advance(24 * time.Hour)
+	w := do(http.MethodGet, "/snippets/standup", "")
+	if w.Code != http.StatusOK || w.Body.String() != "https://meet.example.com/standup" {
+		t.Fatalf("expected the snippet, got %d: %q", w.Code, w.Body)
+	}
+
+	var snippets []api.Snippet
+	if err := json.Unmarshal(do(http.MethodGet, "/snippets", "").Body.Bytes(), &snippets); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(snippets) != 2 || snippets[0].Name != "account" || snippets[1].Name != "standup" {
+		t.Fatalf("expected the snippets sorted by name, got %+v", snippets)
+	}
+	if sn := snippets[1]; sn.Device != "laptop" || !sn.UpdatedAt.Equal(clock.Now().Add(-24*time.Hour)) {
+		t.Errorf("expected the device and time of the snippet, got %+v", sn)
+	}
+
+	if w := do(http.MethodDelete, "/snippets/standup", ""); w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := do(http.MethodGet, "/snippets/standup", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected the snippet to be deleted, got %d", w.Code)
+	}
+}
+
+func TestPrivateSnippets(t *testing.T) {
+	s := newProxiedServer(t)
+
+	put := func(login, text string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, proxied(http.MethodPut, "/snippets/standup", `{"text":"`+text+`"}`, proxyAddr, login))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+		}
+	}
+	put("zoe@example.com", "zoe's")
+	put("", "shared")
+
+	list := func(login string) []string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, proxied(http.MethodGet, "/api/v1/snippets", "", proxyAddr, login))
+		var snippets []api.Snippet
+		if err := json.Unmarshal(w.Body.Bytes(), &api.Response{Data: &snippets}); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		var texts []string
+		for _, sn := range snippets {
+			texts = append(texts, sn.Text)
+		}
+		return texts
+	}
+	if got := list("zoe@example.com"); !slices.Equal(got, []string{"zoe's"}) {
+		t.Errorf("expected zoe's snippet, got %q", got)
+	}
+	if got := list(""); !slices.Equal(got, []string{"shared"}) {
+		t.Errorf("expected the shared snippet, got %q", got)
+	}
+	if got := list("max@example.com"); len(got) != 0 {
+		t.Errorf("expected max to have no snippets, got %q", got)
+	}
+}
+
+func TestSnippetStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snippets.json")
+
+	st, err := OpenSnippets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.List("")) != 0 {
+		t.Fatal("expected no snippets without a file")
+	}
+
+	standup := api.Snippet{Name: "standup", Text: "https://meet.example.com/standup", UpdatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := st.Put("standup", standup); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Put("zoe@example.com/standup", api.Snippet{Name: "standup", Text: "zoe's"}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected a file only readable by its owner, got %v, %v", info, err)
+	}
+
+	st, err = OpenSnippets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sn, ok := st.Get("standup"); !ok || sn != standup {
+		t.Errorf("expected the snippet to be saved, got %+v", sn)
+	}
+	if got := st.List("zoe@example.com"); len(got) != 1 || got[0].Text != "zoe's" {
+		t.Errorf("expected zoe's snippet to be saved, got %+v", got)
+	}
+
+	if _, ok, err := st.Delete("standup"); !ok || err != nil {
+		t.Fatalf("expected the snippet to be deleted, got %v, %v", ok, err)
+	}
+	st, err = OpenSnippets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.Get("standup"); ok {
+		t.Error("expected the deletion to be saved")
+	}
+}
+
+func TestSnippetStoreErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"invalid JSON": "{",
+		"invalid key":  `{"a b": {"name": "a b"}}`,
+		"wrong name":   `{"standup": {"name": "account"}}`,
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenSnippets(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// Changes that can't be saved are undone.
+	st := newSnippetStore("")
+	st.Put("standup", api.Snippet{Name: "standup", Text: "old"})
+	st.path = filepath.Join(os.DevNull, "snippets.json")
+	if err := st.Put("standup", api.Snippet{Name: "standup", Text: "new"}); err == nil {
+		t.Error("expected an error saving to an invalid path")
+	}
+	if err := st.Put("account", api.Snippet{Name: "account"}); err == nil {
+		t.Error("expected an error saving to an invalid path")
+	}
+	if _, _, err := st.Delete("standup"); err == nil {
+		t.Error("expected an error saving to an invalid path")
+	}
+	if got := st.List(""); len(got) != 1 || got[0].Text != "old" {
+		t.Errorf("expected the snippets to be left as they were, got %+v", got)
+	}
+}
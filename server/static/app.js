@@ -0,0 +1,502 @@
+const channel = document.body.dataset.channel;
+
+function showStatus(elementId, message, isSuccess) {
+    const statusEl = document.getElementById(elementId);
+    statusEl.textContent = message;
+    statusEl.className = `status ${isSuccess ? 'success' : 'error'}`;
+    statusEl.style.display = 'block';
+    setTimeout(() => {
+        statusEl.style.display = 'none';
+    }, 3000);
+}
+
+async function copyToClipboard() {
+    // Secrets can be copied without being revealed.
+    const text = shownText;
+
+    if (!text) {
+        showStatus('copyStatus', 'No content to copy', false);
+        return;
+    }
+
+    try {
+        await navigator.clipboard.writeText(text);
+        showStatus('copyStatus', 'Copied to system clipboard!', true);
+    } catch (error) {
+        showStatus('copyStatus', `Failed to copy: ${error.message}`, false);
+    }
+}
+
+// togglePin pins or unpins the content. The change feed updates the page.
+async function togglePin() {
+    try {
+        const response = await fetch(`/clipboard/pin?channel=${encodeURIComponent(channel)}`, {
+            method: pinned ? 'DELETE' : 'POST'
+        });
+        if (!response.ok) {
+            showStatus('copyStatus', `Error: ${(await response.text()).trim() || response.statusText}`, false);
+        }
+    } catch (error) {
+        showStatus('copyStatus', `Error: ${error.message}`, false);
+    }
+}
+
+async function setClipboard() {
+    const text = document.getElementById('newContent').value;
+    const device = document.getElementById('deviceName').value || 'web';
+
+    if (!text.trim()) {
+        showStatus('setStatus', 'Please enter some text to store', false);
+        return;
+    }
+
+    if (await postContent({text: text, device: device})) {
+        document.getElementById('newContent').value = '';
+    }
+}
+
+function contentURL() {
+    return `/clipboard?channel=${encodeURIComponent(channel)}`;
+}
+
+// postContent sets the clipboard, reporting whether it succeeded. With
+// a passphrase, the content is encrypted first.
+async function postContent(request) {
+    try {
+        if (passphrase()) {
+            const {device, ...content} = request;
+            request = {text: await sealContent(content, passphrase()), device: device};
+        }
+
+        const response = await fetch(contentURL(), {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(request)
+        });
+
+        if (response.ok) {
+            showStatus('setStatus', 'Clipboard content saved successfully', true);
+            return true;
+        }
+        showStatus('setStatus', `Error: ${response.status} ${response.statusText}`, false);
+    } catch (error) {
+        showStatus('setStatus', `Error: ${error.message}`, false);
+    }
+    return false;
+}
+
+// uploadFile sets the clipboard to a file or image, sent as base64.
+async function uploadFile(blob, filename) {
+    const device = document.getElementById('deviceName').value || 'web';
+    const data = await new Promise((resolve, reject) => {
+        const reader = new FileReader();
+        reader.onload = () => resolve(reader.result.slice(reader.result.indexOf(',') + 1));
+        reader.onerror = () => reject(reader.error);
+        reader.readAsDataURL(blob);
+    });
+
+    await postContent({
+        data: data,
+        filename: filename,
+        mime_type: blob.type || 'application/octet-stream',
+        device: device
+    });
+}
+
+// pastedName names clipboard images, which come without a file name.
+function pastedName(type) {
+    const extension = type.split('/')[1]?.split('+')[0] || 'bin';
+    return `pasted.${extension}`;
+}
+
+async function pasteFromClipboard() {
+    try {
+        const items = await navigator.clipboard.read();
+        for (const item of items) {
+            const type = item.types.find((t) => !t.startsWith('text/'));
+            if (type) {
+                await uploadFile(await item.getType(type), pastedName(type));
+                return;
+            }
+        }
+        for (const item of items) {
+            if (item.types.includes('text/plain')) {
+                const text = await (await item.getType('text/plain')).text();
+                const device = document.getElementById('deviceName').value || 'web';
+                await postContent({text: text, device: device});
+                return;
+            }
+        }
+        showStatus('setStatus', 'Nothing to paste', false);
+    } catch (error) {
+        showStatus('setStatus', `Failed to paste: ${error.message}`, false);
+    }
+}
+
+document.getElementById('copyButton').addEventListener('click', copyToClipboard);
+document.getElementById('savePassphraseButton').addEventListener('click', savePassphrase);
+document.getElementById('forgetPassphraseButton').addEventListener('click', forgetPassphrase);
+document.getElementById('setButton').addEventListener('click', setClipboard);
+document.getElementById('pasteButton').addEventListener('click', pasteFromClipboard);
+document.getElementById('revealButton').addEventListener('click', revealContent);
+document.getElementById('pinButton').addEventListener('click', togglePin);
+
+// Content that can't be encoded, such as long text, has no QR code.
+document.querySelector('#contentQR img').addEventListener('error', (e) => {
+    e.target.parentElement.hidden = true;
+});
+
+const dropZone = document.getElementById('dropZone');
+dropZone.addEventListener('dragover', (e) => {
+    e.preventDefault();
+    dropZone.classList.add('active');
+});
+dropZone.addEventListener('dragleave', () => dropZone.classList.remove('active'));
+dropZone.addEventListener('drop', (e) => {
+    e.preventDefault();
+    dropZone.classList.remove('active');
+    const file = e.dataTransfer.files[0];
+    if (file) {
+        uploadFile(file, file.name);
+    }
+});
+
+document.getElementById('fileInput').addEventListener('change', (e) => {
+    const file = e.target.files[0];
+    if (file) {
+        uploadFile(file, file.name);
+    }
+    e.target.value = '';
+});
+
+// Pasting text into the form keeps working: only files are uploaded.
+document.addEventListener('paste', (e) => {
+    const file = e.clipboardData.files[0];
+    if (file) {
+        e.preventDefault();
+        uploadFile(file, file.name || pastedName(file.type));
+    }
+});
+
+// The passphrase lives in session storage: it is gone when the tab is
+// closed, and never leaves the browser.
+const PASSPHRASE_KEY = 'clipshare-passphrase';
+
+function passphrase() {
+    return sessionStorage.getItem(PASSPHRASE_KEY) || '';
+}
+
+function savePassphrase() {
+    const input = document.getElementById('passphrase');
+    if (!input.value) {
+        return;
+    }
+    sessionStorage.setItem(PASSPHRASE_KEY, input.value);
+    input.value = '';
+    passphraseChanged();
+}
+
+function forgetPassphrase() {
+    sessionStorage.removeItem(PASSPHRASE_KEY);
+    passphraseChanged();
+}
+
+function passphraseChanged() {
+    document.getElementById('encryptionState').textContent = passphrase()
+        ? 'Content is encrypted with your passphrase before leaving this page.'
+        : 'Content is sent in the clear. Set the passphrase used by your other devices to encrypt it.';
+    if (lastEvent) {
+        showContent(lastEvent);
+    }
+    loadSnippets();
+}
+
+// Snippets are kept until deleted. With a passphrase, they are encrypted
+// like the clipboard content.
+function snippetURL(name) {
+    return `/snippets/${encodeURIComponent(name)}`;
+}
+
+async function loadSnippets() {
+    try {
+        const response = await fetch('/snippets');
+        if (!response.ok) {
+            throw new Error(`${response.status} ${response.statusText}`);
+        }
+        renderSnippets(await response.json());
+    } catch (error) {
+        showStatus('snippetStatus', `Failed to load snippets: ${error.message}`, false);
+    }
+}
+
+// snippetText returns the text of a snippet, decrypted when needed, or
+// undefined when it can't be.
+async function snippetText(snippet) {
+    if (!isEnvelope(snippet.text)) {
+        return snippet.text;
+    }
+    try {
+        return (await openContent(snippet.text, passphrase())).text || '';
+    } catch (error) {
+        return undefined;
+    }
+}
+
+async function renderSnippets(snippets) {
+    const list = document.getElementById('snippetList');
+    const items = [];
+    for (const snippet of snippets) {
+        const text = await snippetText(snippet);
+
+        const item = document.createElement('li');
+        const name = document.createElement('strong');
+        name.textContent = snippet.name;
+        const preview = document.createElement('span');
+        preview.className = 'snippet-text';
+        preview.textContent = text ?? '(encrypted)';
+        item.append(name, preview);
+
+        if (text !== undefined) {
+            item.append(snippetButton('Copy', async () => {
+                try {
+                    await navigator.clipboard.writeText(text);
+                    showStatus('snippetStatus', `Copied ${snippet.name}`, true);
+                } catch (error) {
+                    showStatus('snippetStatus', `Failed to copy: ${error.message}`, false);
+                }
+            }));
+            item.append(snippetButton('Edit', () => {
+                document.getElementById('snippetName').value = snippet.name;
+                document.getElementById('snippetText').value = text;
+            }));
+        }
+        item.append(snippetButton('Delete', () => deleteSnippet(snippet.name)));
+        items.push(item);
+    }
+    list.replaceChildren(...items);
+}
+
+function snippetButton(label, onClick) {
+    const button = document.createElement('button');
+    button.textContent = label;
+    button.addEventListener('click', onClick);
+    return button;
+}
+
+async function saveSnippet() {
+    const name = document.getElementById('snippetName').value.trim();
+    let text = document.getElementById('snippetText').value;
+    const device = document.getElementById('deviceName').value || 'web';
+
+    if (!/^[A-Za-z0-9._-]{1,64}$/.test(name)) {
+        showStatus('snippetStatus', 'Names are made of letters, digits, ".", "_" and "-"', false);
+        return;
+    }
+    if (!text.trim()) {
+        showStatus('snippetStatus', 'Please enter some text to keep', false);
+        return;
+    }
+
+    try {
+        if (passphrase()) {
+            text = await sealContent({text: text}, passphrase());
+        }
+        const response = await fetch(snippetURL(name), {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({text: text, device: device})
+        });
+        if (!response.ok) {
+            throw new Error(`${response.status} ${response.statusText}`);
+        }
+        document.getElementById('snippetName').value = '';
+        document.getElementById('snippetText').value = '';
+        showStatus('snippetStatus', `Saved ${name}`, true);
+        loadSnippets();
+    } catch (error) {
+        showStatus('snippetStatus', `Error: ${error.message}`, false);
+    }
+}
+
+async function deleteSnippet(name) {
+    if (!confirm(`Delete the snippet ${name}?`)) {
+        return;
+    }
+    try {
+        const response = await fetch(snippetURL(name), {method: 'DELETE'});
+        if (!response.ok && response.status !== 404) {
+            throw new Error(`${response.status} ${response.statusText}`);
+        }
+        loadSnippets();
+    } catch (error) {
+        showStatus('snippetStatus', `Error: ${error.message}`, false);
+    }
+}
+
+document.getElementById('saveSnippetButton').addEventListener('click', saveSnippet);
+
+// The page follows the change feed of its channel. Every (re)connection
+// starts with a snapshot, so nothing is missed while offline.
+let expiresAt = null;
+let pinned = false;
+let reconnectDelay = 1000;
+let reconnectTimer = null;
+let events = null;
+let contentVersion = 0;
+let lastEvent = null;
+let fileURL = null;
+let shownText = '';
+
+// Content that looks like a secret stays masked until revealed. Revealing
+// only applies to the content at hand, not to the next one.
+let revealedEvent = null;
+
+function revealContent() {
+    revealedEvent = lastEvent;
+    showContent(lastEvent);
+}
+
+// showContent renders ev, decrypting it when it holds an envelope.
+async function showContent(ev) {
+    lastEvent = ev;
+    // Bump the version so that the browser fetches new content, and
+    // so that slow decryptions of older events are dropped.
+    const version = ++contentVersion;
+
+    let url = `${contentURL()}&v=${version}`;
+    let placeholder = '(clipboard is empty)';
+    const encrypted = ev.text && isEnvelope(ev.text);
+    if (encrypted) {
+        const sealed = ev.text;
+        ev = {...ev, text: ''};
+        try {
+            if (!passphrase()) {
+                throw new Error('no passphrase');
+            }
+            const content = await openContent(sealed, passphrase());
+            if (version !== contentVersion) {
+                return;
+            }
+            if (content.mime_type) {
+                URL.revokeObjectURL(fileURL);
+                fileURL = URL.createObjectURL(new Blob([base64ToBytes(content.data || '')], {type: content.mime_type}));
+                url = fileURL;
+                ev = {...ev, filename: content.filename, mime_type: content.mime_type};
+            } else {
+                ev.text = content.text || '';
+            }
+        } catch (error) {
+            if (version !== contentVersion) {
+                return;
+            }
+            placeholder = passphrase()
+                ? '(encrypted: wrong passphrase)'
+                : '(encrypted: set the passphrase below to read it)';
+        }
+    }
+
+    const masked = ev.sensitive && revealedEvent !== lastEvent;
+    document.getElementById('sensitiveNotice').hidden = !masked;
+    if (masked) {
+        placeholder = '(hidden secret)';
+    }
+
+    const binary = ev.mime_type && !ev.mime_type.startsWith('text/');
+    const content = document.getElementById('clipboardContent');
+    shownText = ev.text;
+    content.value = masked ? '' : ev.text;
+    content.placeholder = placeholder;
+    content.hidden = binary;
+
+    const preview = document.getElementById('filePreview');
+    preview.hidden = !ev.filename && !binary;
+    if (!preview.hidden) {
+        const image = document.getElementById('imagePreview');
+        // The server sends other images, such as SVG, as downloads.
+        const imageType = (ev.mime_type || '').split(';')[0].trim().toLowerCase();
+        image.hidden = !['image/png', 'image/jpeg', 'image/gif', 'image/webp'].includes(imageType);
+        if (!image.hidden) {
+            image.src = url;
+        }
+
+        const link = document.getElementById('downloadLink');
+        link.href = url;
+        link.download = ev.filename || '';
+        link.textContent = `Download ${ev.filename || ev.mime_type}`;
+    }
+
+    expiresAt = ev.expires_at ? new Date(ev.expires_at) : null;
+    pinned = Boolean(ev.pinned);
+    updateExpiry();
+
+    // Secrets are cleared soon, and can't be pinned.
+    const pinButton = document.getElementById('pinButton');
+    pinButton.hidden = (!lastEvent.text && !lastEvent.mime_type) || ev.sensitive;
+    pinButton.textContent = pinned ? 'Unpin' : 'Pin';
+
+    // The QR code of encrypted content would only hold the envelope, and
+    // the one of a secret would show it.
+    const qr = document.getElementById('contentQR');
+    qr.hidden = !ev.text || encrypted || masked;
+    if (!qr.hidden) {
+        qr.querySelector('img').src = `/clipboard/qr?channel=${encodeURIComponent(channel)}&v=${version}`;
+    }
+}
+
+function updateExpiry() {
+    const expiry = document.getElementById('expiry');
+    if (!expiresAt) {
+        expiry.textContent = '';
+        return;
+    }
+    if (pinned) {
+        expiry.textContent = `Pinned until ${expiresAt.toLocaleTimeString([], {hour: '2-digit', minute: '2-digit'})}`;
+        return;
+    }
+    const seconds = Math.max(0, Math.ceil((expiresAt - Date.now()) / 1000));
+    const minutes = Math.floor(seconds / 60);
+    expiry.textContent = `Expires in ${minutes}:${String(seconds % 60).padStart(2, '0')}`;
+}
+
+function setConnected(connected) {
+    const connection = document.getElementById('connection');
+    connection.textContent = connected ? 'Live' : 'Reconnecting…';
+    connection.classList.toggle('live', connected);
+}
+
+function connect() {
+    clearTimeout(reconnectTimer);
+    if (events) {
+        events.close();
+    }
+
+    events = new EventSource(`/clipboard/events?channel=${encodeURIComponent(channel)}`);
+    events.onopen = () => {
+        reconnectDelay = 1000;
+        setConnected(true);
+    };
+    for (const type of ['snapshot', 'set', 'clear', 'expire', 'pin', 'unpin']) {
+        events.addEventListener(type, (e) => showContent(JSON.parse(e.data)));
+    }
+    // Reconnect ourselves, with backoff: the browser gives up on some
+    // errors, such as the server answering with an error status.
+    events.onerror = () => {
+        events.close();
+        setConnected(false);
+        reconnectTimer = setTimeout(connect, reconnectDelay);
+        reconnectDelay = Math.min(reconnectDelay * 2, 30000);
+    };
+}
+
+if ('serviceWorker' in navigator) {
+    navigator.serviceWorker.register('/sw.js');
+}
+
+passphraseChanged();
+window.addEventListener('online', connect);
+setInterval(updateExpiry, 1000);
+connect();
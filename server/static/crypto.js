@@ -0,0 +1,97 @@
+// Passphrase encryption of clipboard content, in the envelope format of the
+// Go client (see the envelope package): PBKDF2-SHA256 and AES-256-GCM.
+//
+// Sealed content is the JSON of {text} or {data, filename, mime_type}, with
+// data in base64, so that file names and types are encrypted too.
+
+const ENVELOPE_VERSION = 1;
+const ENVELOPE_KDF = 'PBKDF2-SHA256';
+const ENVELOPE_ITERATIONS = 600000;
+const ENVELOPE_MAX_ITERATIONS = 10000000;
+
+function bytesToBase64(bytes) {
+    let binary = '';
+    for (let i = 0; i < bytes.length; i += 0x8000) {
+        binary += String.fromCharCode(...bytes.subarray(i, i + 0x8000));
+    }
+    return btoa(binary);
+}
+
+function base64ToBytes(base64) {
+    return Uint8Array.from(atob(base64), (c) => c.charCodeAt(0));
+}
+
+async function deriveEnvelopeKey(passphrase, salt, iterations) {
+    const material = await crypto.subtle.importKey(
+        'raw', new TextEncoder().encode(passphrase), 'PBKDF2', false, ['deriveKey']);
+    return crypto.subtle.deriveKey(
+        {name: 'PBKDF2', hash: 'SHA-256', salt: salt, iterations: iterations},
+        material, {name: 'AES-GCM', length: 256}, false, ['encrypt', 'decrypt']);
+}
+
+function isEnvelope(text) {
+    text = text.trim();
+    if (!text.startsWith('{') || !text.includes('"clipshare_envelope"')) {
+        return false;
+    }
+    try {
+        return JSON.parse(text).clipshare_envelope > 0;
+    } catch {
+        return false;
+    }
+}
+
+// sealEnvelope encrypts the bytes of plaintext and returns the envelope.
+async function sealEnvelope(plaintext, passphrase) {
+    if (!passphrase) {
+        throw new Error('empty passphrase');
+    }
+    const salt = crypto.getRandomValues(new Uint8Array(16));
+    const nonce = crypto.getRandomValues(new Uint8Array(12));
+    const key = await deriveEnvelopeKey(passphrase, salt, ENVELOPE_ITERATIONS);
+    const ciphertext = await crypto.subtle.encrypt({name: 'AES-GCM', iv: nonce}, key, plaintext);
+
+    return JSON.stringify({
+        clipshare_envelope: ENVELOPE_VERSION,
+        kdf: ENVELOPE_KDF,
+        iterations: ENVELOPE_ITERATIONS,
+        salt: bytesToBase64(salt),
+        nonce: bytesToBase64(nonce),
+        ciphertext: bytesToBase64(new Uint8Array(ciphertext)),
+    });
+}
+
+// openEnvelope decrypts an envelope and returns the plaintext bytes.
+async function openEnvelope(text, passphrase) {
+    if (!passphrase) {
+        throw new Error('empty passphrase');
+    }
+    const envelope = JSON.parse(text);
+    if (envelope.clipshare_envelope !== ENVELOPE_VERSION) {
+        throw new Error(`unsupported envelope version ${envelope.clipshare_envelope}`);
+    }
+    if (envelope.kdf !== ENVELOPE_KDF) {
+        throw new Error(`unsupported key derivation ${envelope.kdf}`);
+    }
+    if (!(envelope.iterations >= 1 && envelope.iterations <= ENVELOPE_MAX_ITERATIONS)) {
+        throw new Error(`invalid iteration count ${envelope.iterations}`);
+    }
+
+    const key = await deriveEnvelopeKey(passphrase, base64ToBytes(envelope.salt), envelope.iterations);
+    try {
+        const plaintext = await crypto.subtle.decrypt(
+            {name: 'AES-GCM', iv: base64ToBytes(envelope.nonce)}, key, base64ToBytes(envelope.ciphertext));
+        return new Uint8Array(plaintext);
+    } catch {
+        throw new Error('wrong passphrase or corrupted envelope');
+    }
+}
+
+// sealContent encrypts {text} or {data, filename, mime_type}.
+async function sealContent(content, passphrase) {
+    return sealEnvelope(new TextEncoder().encode(JSON.stringify(content)), passphrase);
+}
+
+async function openContent(text, passphrase) {
+    return JSON.parse(new TextDecoder().decode(await openEnvelope(text, passphrase)));
+}
@@ -0,0 +1,32 @@
+// The service worker makes Clipshare installable. It only caches the static
+// assets: clipboard content is always fetched from the server, and never
+// stored on the device.
+const CACHE = 'clipshare-v2';
+const ASSETS = [
+    '/manifest.webmanifest',
+    '/crypto.js',
+    '/icons/icon.svg',
+    '/icons/icon-192.png',
+    '/icons/icon-512.png',
+];
+
+self.addEventListener('install', (event) => {
+    event.waitUntil(caches.open(CACHE).then((cache) => cache.addAll(ASSETS)));
+    self.skipWaiting();
+});
+
+self.addEventListener('activate', (event) => {
+    event.waitUntil(
+        caches.keys()
+            .then((keys) => Promise.all(keys.filter((key) => key !== CACHE).map((key) => caches.delete(key))))
+            .then(() => self.clients.claim())
+    );
+});
+
+self.addEventListener('fetch', (event) => {
+    const url = new URL(event.request.url);
+    if (event.request.method !== 'GET' || url.origin !== location.origin || !ASSETS.includes(url.pathname)) {
+        return;
+    }
+    event.respondWith(caches.match(event.request).then((cached) => cached || fetch(event.request)));
+});
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// apiVersions are the versions of the API, listed in the discovery document.
+var apiVersions = []api.Version{{Version: "v1", URL: "/api/v1"}}
+
+// writeData answers a request of the versioned API with data.
+func writeData(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.Response{Data: data})
+}
+
+// writeError answers a request of the versioned API with an error.
+func writeError(w http.ResponseWriter, message string, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(api.Response{Error: &api.Error{Status: code, Message: message}})
+}
+
+// apiErrors turns the plain text errors of h, as written by http.Error, into
+// the JSON errors of the versioned API. This lets the versioned API share
+// the handlers of the unversioned one.
+func apiErrors(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &apiErrorWriter{ResponseWriter: w}
+		h(ew, r)
+		if ew.status != 0 {
+			writeError(w, strings.TrimSpace(ew.message.String()), ew.status)
+		}
+	})
+}
+
+// apiErrorWriter holds back error responses, so that apiErrors can rewrite
+// them.
+type apiErrorWriter struct {
+	http.ResponseWriter
+	status  int
+	message bytes.Buffer
+}
+
+func (w *apiErrorWriter) WriteHeader(code int) {
+	if code >= http.StatusBadRequest {
+		w.status = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *apiErrorWriter) Write(b []byte) (int, error) {
+	if w.status != 0 {
+		return w.message.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *apiErrorWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.status == 0 {
+		f.Flush()
+	}
+}
+
+func (w *apiErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// clip returns the content of a channel, as served by the versioned API.
+func (s *Server) clip(channel string) api.Clip {
+	e, expiresAt, pinned, _ := s.lookup(channel)
+	return newClip(channel, e, expiresAt, pinned)
+}
+
+// newClip describes an entry, which is empty for empty channels.
+func newClip(channel string, e Entry, expiresAt time.Time, pinned bool) api.Clip {
+	clip := api.Clip{
+		Channel:   channelName(channel),
+		Filename:  e.Filename,
+		MIMEType:  e.MIMEType,
+		Device:    e.Device,
+		Sensitive: e.Sensitive,
+		User:      e.User,
+		Pinned:    pinned,
+		ExpiresAt: expiresAt,
+	}
+	if e.IsText() {
+		clip.Text = string(e.Data)
+	} else {
+		clip.Data = e.Data
+	}
+	return clip
+}
+
+// capabilities lists the features of the server, for the discovery
+// document.
+func (s *Server) capabilities() []string {
+	caps := []string{api.CapabilityChannels, api.CapabilityFiles, api.CapabilityEvents, api.CapabilityQR, api.CapabilityPin, api.CapabilitySnippets}
+	if s.peerToken != "" {
+		caps = append(caps, api.CapabilityReplication)
+	}
+	return caps
+}
+
+// discoveryHandler serves the versions and capabilities of the API. It is
+// not versioned itself.
+func (s *Server) discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(api.Discovery{Versions: apiVersions, Capabilities: s.capabilities()})
+}
+
+// v1ClipboardHandler is /clipboard with JSON responses: the content of the
+// channel, after the change for sets and clears.
+func (s *Server) v1ClipboardHandler(w http.ResponseWriter, r *http.Request) {
+	channel, ok := channelFromRequest(r)
+	if !ok {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeData(w, s.clip(channel))
+
+	case http.MethodPost:
+		req, ok := readSetRequest(w, r)
+		if !ok {
+			return
+		}
+
+		s.SetEntry(channel, entryFromRequest(r, req))
+
+		writeData(w, s.clip(channel))
+
+	case http.MethodDelete:
+		s.Clear(channel)
+
+		writeData(w, s.clip(channel))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) v1ChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeData(w, s.channelsOf(r))
+}
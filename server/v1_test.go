@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// v1Request sends a request to s and decodes the response envelope into
+// data.
+func v1Request(t *testing.T, s *Server, method, target, body string, data any) (int, *api.Error) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected Content-Type application/json, got %s", ct)
+	}
+	resp := api.Response{Data: data}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body, err)
+	}
+	return w.Code, resp.Error
+}
+
+func TestV1Clipboard(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	var clip api.Clip
+	if code, apiErr := v1Request(t, s, http.MethodGet, "/api/v1/clipboard", "", &clip); code != http.StatusOK || apiErr != nil {
+		t.Fatalf("unexpected status %d and error %+v", code, apiErr)
+	}
+	if !reflect.DeepEqual(clip, api.Clip{Channel: DefaultChannel}) {
+		t.Errorf("expected an empty clip, got %+v", clip)
+	}
+
+	clip = api.Clip{}
+	v1Request(t, s, http.MethodPost, "/api/v1/clipboard?channel=work", `{"text":"hello","device":"laptop"}`, &clip)
+	want := api.Clip{
+		Channel:   "work",
+		Text:      "hello",
+		MIMEType:  TextMIMEType,
+		Device:    "laptop",
+		ExpiresAt: time.Date(2025, 1, 1, 0, 1, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(clip, want) {
+		t.Errorf("expected %+v, got %+v", want, clip)
+	}
+	if s.Content("work") != "hello" {
+		t.Errorf("expected the content to be set, got %q", s.Content("work"))
+	}
+
+	clip = api.Clip{}
+	v1Request(t, s, http.MethodPost, "/api/v1/clipboard", `{"data":"AAE=","filename":"a.bin"}`, &clip)
+	if !bytes.Equal(clip.Data, []byte{0, 1}) || clip.Text != "" || clip.Filename != "a.bin" || clip.MIMEType != "application/octet-stream" {
+		t.Errorf("unexpected file clip %+v", clip)
+	}
+
+	clip = api.Clip{}
+	v1Request(t, s, http.MethodDelete, "/api/v1/clipboard?channel=work", "", &clip)
+	if !reflect.DeepEqual(clip, api.Clip{Channel: "work"}) || s.Content("work") != "" {
+		t.Errorf("expected the channel to be cleared, got %+v", clip)
+	}
+}
+
+func TestV1Errors(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	tests := []struct {
+		method, target, body string
+		status               int
+		message              string
+	}{
+		{http.MethodGet, "/api/v1/clipboard?channel=a/b", "", http.StatusBadRequest, "Invalid channel name"},
+		{http.MethodPost, "/api/v1/clipboard", "{", http.StatusBadRequest, "Invalid JSON"},
+		{http.MethodPut, "/api/v1/clipboard", "", http.StatusMethodNotAllowed, "Method not allowed"},
+		{http.MethodGet, "/api/v1/clipboard/qr", "", http.StatusNotFound, "Clipboard is empty"},
+		{http.MethodPost, "/api/v1/channels", "", http.StatusMethodNotAllowed, "Method not allowed"},
+		{http.MethodGet, "/api/v1/unknown", "", http.StatusNotFound, "404 page not found"},
+		{http.MethodGet, "/api/v2/clipboard", "", http.StatusNotFound, "404 page not found"},
+	}
+	for _, tt := range tests {
+		code, apiErr := v1Request(t, s, tt.method, tt.target, tt.body, nil)
+		want := &api.Error{Status: tt.status, Message: tt.message}
+		if code != tt.status || !reflect.DeepEqual(apiErr, want) {
+			t.Errorf("%s %s: expected status %d and error %+v, got %d and %+v", tt.method, tt.target, tt.status, want, code, apiErr)
+		}
+	}
+}
+
+func TestV1Channels(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Set("work", "a", "test")
+	s.Set(DefaultChannel, "b", "test")
+
+	var channels []string
+	v1Request(t, s, http.MethodGet, "/api/v1/channels", "", &channels)
+	if !slices.Equal(channels, []string{"default", "work"}) {
+		t.Errorf("unexpected channels %v", channels)
+	}
+
+	s.Clear("work")
+	s.Clear(DefaultChannel)
+	channels = nil
+	v1Request(t, s, http.MethodGet, "/api/v1/channels", "", &channels)
+	if channels == nil || len(channels) != 0 {
+		t.Errorf("expected an empty list, got %#v", channels)
+	}
+}
+
+func TestV1Events(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.Set(DefaultChannel, "streamed", "test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/clipboard/events", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		s.ServeHTTP(w, req)
+		close(done)
+	}()
+
+	// Give the handler time to write the snapshot before stopping it.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected Content-Type text/event-stream, got %s", ct)
+	}
+	if !w.Flushed {
+		t.Error("expected the stream to be flushed")
+	}
+	if !strings.HasPrefix(w.Body.String(), "event: snapshot\n") {
+		t.Errorf("expected a snapshot, got %q", w.Body)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	var d api.Discovery
+	if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := api.Discovery{
+		Versions:     []api.Version{{Version: "v1", URL: "/api/v1"}},
+		Capabilities: []string{api.CapabilityChannels, api.CapabilityFiles, api.CapabilityEvents, api.CapabilityQR, api.CapabilityPin, api.CapabilitySnippets},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("expected %+v, got %+v", want, d)
+	}
+
+	s = newSpecServer(t)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api", nil))
+	d = api.Discovery{}
+	json.Unmarshal(w.Body.Bytes(), &d)
+	if !slices.Contains(d.Capabilities, api.CapabilityReplication) {
+		t.Errorf("expected replication to be listed with a peer token, got %v", d.Capabilities)
+	}
+}
+
+func TestV1CORS(t *testing.T) {
+	s := newCORSServer(t, "https://example.com")
+
+	for _, target := range []string{"/api", "/api/v1/clipboard"} {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"text":"x"}`))
+		req.Header.Set("Origin", "https://example.com")
+		req.Header.Set("Sec-Fetch-Site", "cross-site")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		if w.Header().Get("Access-Control-Allow-Origin") != "https://example.com" {
+			t.Errorf("expected %s to be shared with allowed origins", target)
+		}
+		if w.Code == http.StatusForbidden {
+			t.Errorf("expected %s to accept requests from allowed origins", target)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+// Headers of the requests sent to webhook targets.
+const (
+	// WebhookEventHeader carries the type of the event.
+	WebhookEventHeader = "X-Clipshare-Event"
+
+	// WebhookSignatureHeader carries "sha256=" followed by the hex-encoded
+	// HMAC-SHA256 of the body, keyed with the secret of the target.
+	WebhookSignatureHeader = "X-Clipshare-Signature"
+)
+
+const (
+	// webhookQueueSize is how many events may wait to be delivered to a
+	// target before further events are dropped for it.
+	webhookQueueSize = 256
+
+	// webhookTimeout bounds a single delivery attempt.
+	webhookTimeout = 10 * time.Second
+
+	// webhookAttempts is how many times an event is sent before giving up.
+	webhookAttempts = 5
+
+	// maxWebhookBackoff bounds the delay between attempts.
+	maxWebhookBackoff = time.Minute
+)
+
+// webhookBackoff is the delay before the first retry. It doubles on every
+// attempt, up to maxWebhookBackoff.
+var webhookBackoff = time.Second
+
+// ContentPolicy controls whether the content of the clipboard is sent to a
+// webhook target.
+type ContentPolicy string
+
+const (
+	// ContentNone only sends metadata, such as the channel and device.
+	ContentNone ContentPolicy = "none"
+
+	// ContentText also sends text content, but not files.
+	ContentText ContentPolicy = "text"
+
+	// ContentAll also sends text content and files.
+	ContentAll ContentPolicy = "all"
+)
+
+// Webhook is a target that every set, clear and expiry is POSTed to, as an
+// api.WebhookEvent.
+type Webhook struct {
+	URL string `json:"url"`
+
+	// Secret signs the requests, see WebhookSignatureHeader. Requests are
+	// not signed when it is empty.
+	Secret string `json:"secret"`
+
+	// Content is the content policy of the target. Empty and unknown
+	// policies are ContentNone. Content that looks like a secret is never
+	// sent.
+	Content ContentPolicy `json:"content"`
+}
+
+// webhook is a target that events are delivered to, in order, by a
+// background worker.
+type webhook struct {
+	Webhook
+	queue chan api.WebhookEvent
+}
+
+// startWebhooks starts a worker for each webhook target.
+func (s *Server) startWebhooks(targets []Webhook) {
+	client := &http.Client{Timeout: webhookTimeout}
+	backoff := webhookBackoff
+	for _, target := range targets {
+		h := &webhook{Webhook: target, queue: make(chan api.WebhookEvent, webhookQueueSize)}
+		s.webhooks = append(s.webhooks, h)
+
+		s.webhooksDone.Add(1)
+		go func() {
+			defer s.webhooksDone.Done()
+			for ev := range h.queue {
+				if err := s.deliver(client, h, ev, backoff); err != nil {
+					log.Printf("clipshare: failed to deliver %s of channel %q to %s: %v", ev.Type, ev.Channel, h.URL, err)
+				}
+			}
+		}()
+	}
+}
+
+// notify queues an event for every webhook target, with the content their
+// policy allows. It must be called with s.mu held, so that targets receive
+// events in the order they happened.
+func (s *Server) notify(typ, channel string, e Entry, expiresAt time.Time) {
+	if s.closed || len(s.webhooks) == 0 {
+		return
+	}
+
+	// Channels are named as in the API. Targets see the channels of every
+	// user, so private ones are told apart by their user, which clears and
+	// expiries don't record.
+	ev := e.event(typ, channelName(channel))
+	if login := channelScope(channel); login != "" && ev.User.Login == "" {
+		ev.User = api.User{Login: login}
+	}
+	ev.ExpiresAt = expiresAt
+	ev.Text = ""
+	now := s.clock.Now()
+
+	for _, h := range s.webhooks {
+		wev := api.WebhookEvent{Event: ev, Time: now}
+		switch {
+		case e.Sensitive:
+		case e.IsText() && (h.Content == ContentText || h.Content == ContentAll):
+			wev.Text = string(e.Data)
+		case !e.IsText() && h.Content == ContentAll:
+			wev.Data = e.Data
+		}
+
+		select {
+		case h.queue <- wev:
+		default:
+			log.Printf("clipshare: dropping %s of channel %q for %s: queue full", typ, channel, h.URL)
+		}
+	}
+}
+
+// deliver sends ev to h, retrying with exponential backoff on network
+// errors and on server errors. Once the server is closed, events are only
+// tried once.
+func (s *Server) deliver(client *http.Client, h *webhook, ev api.WebhookEvent, backoff time.Duration) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(client, h, ev.Type, body)
+		if err == nil || !retry || attempt == webhookAttempts {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-s.done:
+			return err
+		}
+		backoff = min(2*backoff, maxWebhookBackoff)
+	}
+}
+
+// post sends a signed event to h, reporting whether a failure may go away by
+// retrying.
+func (s *Server) post(client *http.Client, h *webhook, typ string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, typ)
+	if h.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(h.Secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+		return retry, fmt.Errorf("target returned %s", resp.Status)
+	}
+	return false, nil
+}
+
+// SignWebhook returns the signature of a webhook body, as sent in
+// WebhookSignatureHeader. Receivers recompute it with the shared secret and
+// compare the two with hmac.Equal.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
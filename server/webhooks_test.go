@@ -0,0 +1,192 @@
+package server
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aldur/clipshare/api"
+)
+
+const testWebhookSecret = "webhook-secret"
+
+// delivery is a request received by a webhook target.
+type delivery struct {
+	header http.Header
+	body   []byte
+	event  api.WebhookEvent
+}
+
+// newReceiver starts a webhook target answering with the statuses returned
+// by status, and returns its URL and the requests it accepted.
+func newReceiver(t *testing.T, status func(attempt int64) int) (string, <-chan delivery) {
+	t.Helper()
+
+	deliveries := make(chan delivery, 16)
+	var attempts atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := status(attempts.Add(1))
+		w.WriteHeader(code)
+		if code != http.StatusOK {
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		d := delivery{header: r.Header, body: body}
+		if err := json.Unmarshal(body, &d.event); err != nil {
+			t.Errorf("invalid JSON: %v", err)
+		}
+		deliveries <- d
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL, deliveries
+}
+
+func alwaysOK(int64) int { return http.StatusOK }
+
+func nextDelivery(t *testing.T, deliveries <-chan delivery) delivery {
+	t.Helper()
+
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a webhook")
+		return delivery{}
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	textURL, textDeliveries := newReceiver(t, alwaysOK)
+	noneURL, noneDeliveries := newReceiver(t, alwaysOK)
+
+	clock := newFakeClock()
+	s := New(Options{TTL: time.Minute, Clock: clock, Webhooks: []Webhook{
+		{URL: textURL, Secret: testWebhookSecret, Content: ContentText},
+		{URL: noneURL},
+	}})
+	// Registered after the receivers, so it runs before they close.
+	t.Cleanup(s.Close)
+
+	s.Set(DefaultChannel, "hello", "laptop")
+	s.SetEntry(DefaultChannel, Entry{Data: []byte{0, 1}, Filename: "a.bin", MIMEType: "application/octet-stream"})
+	s.Clear(DefaultChannel)
+	s.Set("work", "bye", "phone")
+	clock.Advance(time.Minute)
+
+	want := []struct {
+		typ, channel, text string
+		file               string
+	}{
+		{api.EventSet, DefaultChannel, "hello", ""},
+		{api.EventSet, DefaultChannel, "", "a.bin"},
+		{api.EventClear, DefaultChannel, "", ""},
+		{api.EventSet, "work", "bye", ""},
+		{api.EventExpire, "work", "", ""},
+	}
+	for _, w := range want {
+		d := nextDelivery(t, textDeliveries)
+		ev := d.event
+		if ev.Type != w.typ || ev.Channel != w.channel || ev.Text != w.text || ev.Filename != w.file || ev.Data != nil {
+			t.Errorf("expected %s of %s with %q, got %+v", w.typ, w.channel, w.text, ev)
+		}
+		if got := d.header.Get(WebhookEventHeader); got != w.typ {
+			t.Errorf("expected %s %q, got %q", WebhookEventHeader, w.typ, got)
+		}
+		if sig := d.header.Get(WebhookSignatureHeader); !hmac.Equal([]byte(sig), []byte(SignWebhook(testWebhookSecret, d.body))) {
+			t.Errorf("invalid signature %q", sig)
+		}
+		if ev.Time.IsZero() {
+			t.Error("expected the time of the event")
+		}
+
+		d = nextDelivery(t, noneDeliveries)
+		if d.event.Type != w.typ || d.event.Text != "" || d.event.Data != nil {
+			t.Errorf("expected %s without content, got %+v", w.typ, d.event)
+		}
+		if d.header.Get(WebhookSignatureHeader) != "" {
+			t.Error("expected no signature without a secret")
+		}
+	}
+}
+
+func TestWebhookContentPolicies(t *testing.T) {
+	allURL, allDeliveries := newReceiver(t, alwaysOK)
+
+	s := New(Options{TTL: time.Minute, Clock: newFakeClock(), Webhooks: []Webhook{{URL: allURL, Content: ContentAll}}})
+	t.Cleanup(s.Close)
+
+	s.SetEntry(DefaultChannel, Entry{Data: []byte{0, 1}, Filename: "a.bin", MIMEType: "application/octet-stream", Device: "laptop"})
+	d := nextDelivery(t, allDeliveries)
+	if string(d.event.Data) != "\x00\x01" || d.event.Filename != "a.bin" || d.event.Device != "laptop" || d.event.ExpiresAt.IsZero() {
+		t.Errorf("expected the file, got %+v", d.event)
+	}
+
+	s.Set(DefaultChannel, "token: "+testGitHubToken, "laptop")
+	d = nextDelivery(t, allDeliveries)
+	if d.event.Text != "" || !d.event.Sensitive {
+		t.Errorf("expected secrets never to be sent, got %+v", d.event)
+	}
+}
+
+func TestWebhookPrivateChannel(t *testing.T) {
+	url, deliveries := newReceiver(t, alwaysOK)
+
+	s := New(Options{TTL: time.Minute, Clock: newFakeClock(), Webhooks: []Webhook{{URL: url, Content: ContentText}}})
+	t.Cleanup(s.Close)
+
+	zoe := api.User{Login: "zoe@example.com", Name: "Zoe"}
+	channel := scopeChannel(zoe, "work")
+	s.SetEntry(channel, Entry{Data: []byte("hello"), MIMEType: TextMIMEType, Device: "laptop", User: zoe})
+	s.Clear(channel)
+
+	set, clear := nextDelivery(t, deliveries), nextDelivery(t, deliveries)
+	if set.event.Channel != "work" || set.event.User != zoe || set.event.Text != "hello" {
+		t.Errorf("expected the set of zoe's work channel, got %+v", set.event)
+	}
+	if clear.event.Type != api.EventClear || clear.event.Channel != "work" || clear.event.User.Login != zoe.Login {
+		t.Errorf("expected the clear of zoe's work channel, got %+v", clear.event)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	backoff := webhookBackoff
+	webhookBackoff = time.Millisecond
+	t.Cleanup(func() { webhookBackoff = backoff })
+
+	// Fails twice, then succeeds.
+	flakyURL, flakyDeliveries := newReceiver(t, func(attempt int64) int {
+		if attempt <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	// Rejects the first event, which is not retried, then accepts the
+	// second.
+	rejectingURL, rejectingDeliveries := newReceiver(t, func(attempt int64) int {
+		if attempt == 1 {
+			return http.StatusBadRequest
+		}
+		return http.StatusOK
+	})
+
+	s := New(Options{TTL: time.Minute, Clock: newFakeClock(), Webhooks: []Webhook{{URL: flakyURL}, {URL: rejectingURL}}})
+	t.Cleanup(s.Close)
+
+	s.Set(DefaultChannel, "hello", "first")
+	s.Set(DefaultChannel, "bye", "second")
+
+	for _, want := range []string{"first", "second"} {
+		if d := nextDelivery(t, flakyDeliveries); d.event.Device != want {
+			t.Errorf("expected the set from %s, got %+v", want, d.event)
+		}
+	}
+	if d := nextDelivery(t, rejectingDeliveries); d.event.Device != "second" {
+		t.Errorf("expected only the set from second, got %+v", d.event)
+	}
+}
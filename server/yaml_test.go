@@ -0,0 +1,283 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML that openapi.yaml is written in: block
+// mappings and sequences, flow sequences, quoted and plain scalars, and
+// literal block scalars. Mappings become map[string]any, sequences []any,
+// and every scalar a string.
+func parseYAML(data []byte) (any, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")}
+	v, err := p.node(0)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, ok := p.peek(); ok {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return v, nil
+}
+
+type yamlParser struct {
+	lines []string
+	n     int // index of the next line
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("yaml: line %d: %s", p.n+1, fmt.Sprintf(format, args...))
+}
+
+// peek returns the indentation and text of the next line that is neither
+// blank nor a comment, without consuming it.
+func (p *yamlParser) peek() (int, string, bool) {
+	for ; p.n < len(p.lines); p.n++ {
+		line := strings.TrimRight(p.lines[p.n], " \t")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || strings.HasPrefix(text, "#") || text == "---" {
+			continue
+		}
+		return len(line) - len(text), text, true
+	}
+	return 0, "", false
+}
+
+// node parses the block starting on the next line, if it is indented by at
+// least indent. An empty block is nil.
+func (p *yamlParser) node(indent int) (any, error) {
+	n, text, ok := p.peek()
+	if !ok || n < indent {
+		return nil, nil
+	}
+	if isSequenceItem(text) {
+		return p.sequence(n)
+	}
+	return p.mapping(n)
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	m := make(map[string]any)
+	for {
+		n, text, ok := p.peek()
+		if !ok || n < indent || (n == indent && isSequenceItem(text)) {
+			return m, nil
+		}
+		if n > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+
+		key, rest, ok := splitKey(text)
+		if !ok {
+			return nil, p.errorf("expected a key")
+		}
+		if _, dup := m[key]; dup {
+			return nil, p.errorf("duplicate key %q", key)
+		}
+		p.n++
+
+		var v any
+		var err error
+		switch {
+		case rest == "|" || rest == "|-":
+			v = p.literal(indent, rest == "|-")
+		case rest != "":
+			v, err = parseFlow(rest)
+		default:
+			// Sequences may sit at the same indentation as their key.
+			if n, text, ok := p.peek(); ok && n == indent && isSequenceItem(text) {
+				v, err = p.sequence(indent)
+			} else {
+				v, err = p.node(indent + 1)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+}
+
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	var s []any
+	for {
+		n, text, ok := p.peek()
+		if !ok || n != indent || !isSequenceItem(text) {
+			return s, nil
+		}
+		item := strings.TrimLeft(strings.TrimPrefix(text, "-"), " ")
+
+		var v any
+		var err error
+		switch {
+		case item == "":
+			p.n++
+			v, err = p.node(indent + 1)
+		case isSequenceItem(item) || isMappingItem(item):
+			// Parse the rest of the line as the first line of a block
+			// indented past the dash.
+			offset := len(text) - len(item)
+			p.lines[p.n] = strings.Repeat(" ", indent+offset) + item
+			v, err = p.node(indent + offset)
+		default:
+			p.n++
+			v, err = parseFlow(item)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, v)
+	}
+}
+
+func isMappingItem(text string) bool {
+	_, _, ok := splitKey(text)
+	return ok && !strings.HasPrefix(text, "[")
+}
+
+// literal reads the lines of a block scalar more indented than its key. The
+// final line break is kept unless strip is set.
+func (p *yamlParser) literal(indent int, strip bool) string {
+	var lines []string
+	block := -1
+	for ; p.n < len(p.lines); p.n++ {
+		line := strings.TrimRight(p.lines[p.n], " \t")
+		text := strings.TrimLeft(line, " ")
+		if text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		n := len(line) - len(text)
+		if n <= indent {
+			break
+		}
+		if block < 0 {
+			block = n
+		}
+		lines = append(lines, line[min(block, n):])
+	}
+
+	s := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if !strip && s != "" {
+		s += "\n"
+	}
+	return s
+}
+
+// splitKey splits a "key: value" line. The key may be quoted.
+func splitKey(text string) (key, rest string, ok bool) {
+	i := 0
+	if text[0] == '\'' || text[0] == '"' {
+		end := closingQuote(text)
+		if end < 0 {
+			return "", "", false
+		}
+		i = end + 1
+		if i < len(text) && text[i] != ':' {
+			return "", "", false
+		}
+	} else {
+		i = strings.Index(text, ": ")
+		if i < 0 {
+			if !strings.HasSuffix(text, ":") {
+				return "", "", false
+			}
+			i = len(text) - 1
+		}
+	}
+	if i >= len(text) {
+		return "", "", false
+	}
+
+	k, err := parseScalar(text[:i])
+	if err != nil {
+		return "", "", false
+	}
+	return k, strings.TrimSpace(text[i+1:]), true
+}
+
+// closingQuote returns the index of the quote closing the string that text
+// starts with, or -1.
+func closingQuote(text string) int {
+	q := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case q == '"' && text[i] == '\\':
+			i++
+		case text[i] == q && q == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseFlow parses a scalar, or a flow sequence of scalars.
+func parseFlow(text string) (any, error) {
+	if !strings.HasPrefix(text, "[") {
+		return parseScalar(text)
+	}
+	if !strings.HasSuffix(text, "]") {
+		return nil, fmt.Errorf("yaml: unterminated flow sequence %q", text)
+	}
+
+	s := []any{}
+	inner := strings.TrimSpace(text[1 : len(text)-1])
+	for inner != "" {
+		end := strings.IndexByte(inner, ',')
+		if inner[0] == '\'' || inner[0] == '"' {
+			q := closingQuote(inner)
+			if q < 0 {
+				return nil, fmt.Errorf("yaml: unterminated string in %q", text)
+			}
+			end = strings.IndexByte(inner[q:], ',')
+			if end >= 0 {
+				end += q
+			}
+		}
+		if end < 0 {
+			end = len(inner)
+		}
+
+		v, err := parseScalar(inner[:end])
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, v)
+		inner = strings.TrimSpace(strings.TrimPrefix(inner[end:], ","))
+	}
+	return s, nil
+}
+
+func parseScalar(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", nil
+	}
+
+	switch text[0] {
+	case '\'':
+		if closingQuote(text) != len(text)-1 {
+			return "", fmt.Errorf("yaml: invalid string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case '"':
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return "", fmt.Errorf("yaml: invalid string %s", text)
+		}
+		return s, nil
+	}
+
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	return text, nil
+}